@@ -0,0 +1,196 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+const (
+	mongoDefaultReconnectInterval    = time.Second
+	mongoDefaultReconnectMaxInterval = 30 * time.Second
+	mongoBreakerThreshold            = 3
+)
+
+type mongoBreaker struct {
+	mutex    sync.RWMutex
+	open     bool
+	lastErr  error
+	since    time.Time
+	failures int
+	streak   int
+	min      time.Duration
+	max      time.Duration
+	timeout  time.Duration
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newMongoBreaker(min, max, timeout time.Duration) *mongoBreaker {
+	if min <= 0 {
+		min = mongoDefaultReconnectInterval
+	}
+	if max < min {
+		max = mongoDefaultReconnectMaxInterval
+		if max < min {
+			max = min
+		}
+	}
+	return &mongoBreaker{min: min, max: max, timeout: timeout, wake: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (br *mongoBreaker) trip(err error) {
+	br.mutex.Lock()
+	if !br.open {
+		br.since = time.Now()
+	}
+	br.open = true
+	br.lastErr = err
+	br.failures++
+	br.mutex.Unlock()
+}
+
+func (br *mongoBreaker) reset() {
+	br.mutex.Lock()
+	if br.open {
+		br.since = time.Now()
+	}
+	br.open = false
+	br.lastErr = nil
+	br.failures = 0
+	br.streak = 0
+	br.mutex.Unlock()
+}
+
+// record feeds an operation result into the breaker: consecutive
+// connectivity failures open it and wake the probe, a success clears the
+// streak. Closing an open breaker is left to the probe.
+func (br *mongoBreaker) record(err error) {
+	if br == nil {
+		return
+	}
+	if err != nil && !isMongoConnectivityError(err) {
+		return
+	}
+	br.mutex.Lock()
+	if err == nil {
+		if !br.open {
+			br.streak = 0
+		}
+		br.mutex.Unlock()
+		return
+	}
+	br.streak++
+	tripped := !br.open && br.streak >= mongoBreakerThreshold
+	br.mutex.Unlock()
+	if !tripped {
+		return
+	}
+	br.trip(err)
+	select {
+	case br.wake <- struct{}{}:
+	default:
+	}
+}
+
+func isMongoConnectivityError(err error) bool {
+	var le mongo.LabeledError
+	if errors.As(err, &le) && le.HasErrorLabel("NetworkError") {
+		return true
+	}
+	return errors.Is(err, topology.ErrServerSelectionTimeout)
+}
+
+func (br *mongoBreaker) state() (bool, error, time.Time) {
+	br.mutex.RLock()
+	defer br.mutex.RUnlock()
+	return br.open, br.lastErr, br.since
+}
+
+func (br *mongoBreaker) check(op string) error {
+	if br == nil {
+		return nil
+	}
+	open, lastErr, since := br.state()
+	if !open {
+		return nil
+	}
+	return data.Error(op, data.ErrDriver, fmt.Errorf("mongodb unavailable since %s: %v", since.Format(time.RFC3339), lastErr))
+}
+
+func (br *mongoBreaker) backoff() time.Duration {
+	br.mutex.RLock()
+	open, failures := br.open, br.failures
+	br.mutex.RUnlock()
+	if !open {
+		return br.max
+	}
+	wait := br.min
+	for i := 1; i < failures && wait < br.max; i++ {
+		wait *= 2
+	}
+	if wait > br.max {
+		wait = br.max
+	}
+	return wait
+}
+
+func (br *mongoBreaker) run(cli *mongo.Client) {
+	defer close(br.done)
+	for {
+		select {
+		case <-br.stop:
+			return
+		default:
+		}
+		br.ping(cli)
+		timer := time.NewTimer(br.backoff())
+	wait:
+		select {
+		case <-br.stop:
+			timer.Stop()
+			return
+		case <-br.wake:
+			// an operation tripped the breaker: re-probe on the short interval
+			timer.Reset(br.backoff())
+			goto wait
+		case <-timer.C:
+		}
+	}
+}
+
+func (br *mongoBreaker) ping(cli *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), br.timeout)
+	defer cancel()
+	if err := cli.Ping(ctx, nil); err != nil {
+		br.trip(err)
+		return
+	}
+	br.reset()
+}
+
+func (br *mongoBreaker) close() {
+	if br == nil {
+		return
+	}
+	select {
+	case <-br.stop:
+	default:
+		close(br.stop)
+	}
+	<-br.done
+}
+
+func (b *mongoBase) ensureAvailable(op string) error {
+	if b == nil || b.conn == nil {
+		return nil
+	}
+	return b.conn.breaker.check(op)
+}
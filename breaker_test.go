@@ -0,0 +1,96 @@
+package data_mongodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+func TestMongoBreakerFailsFastUntilReset(t *testing.T) {
+	br := newMongoBreaker(100*time.Millisecond, time.Second, time.Second)
+	base := &mongoBase{inst: &data.Instance{Name: "lazy"}, conn: &mongodbConnection{breaker: br}}
+	if err := base.ensureAvailable("users.query"); err != nil {
+		t.Fatalf("closed breaker should allow operations, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		br.trip(errors.New("connection refused"))
+	}
+	if err := base.ensureWritable("users.insert"); !errors.Is(err, data.ErrDriver) {
+		t.Fatalf("expected driver error while breaker is open, got %v", err)
+	}
+	if wait := br.backoff(); wait != 400*time.Millisecond {
+		t.Fatalf("expected exponential backoff of 400ms, got %s", wait)
+	}
+
+	br.reset()
+	if err := base.ensureAvailable("users.query"); err != nil {
+		t.Fatalf("reset breaker should allow operations, got %v", err)
+	}
+	if wait := br.backoff(); wait != time.Second {
+		t.Fatalf("healthy breaker should ping at max interval, got %s", wait)
+	}
+}
+
+func TestMongoBreakerOpensOnOperationErrors(t *testing.T) {
+	br := newMongoBreaker(100*time.Millisecond, time.Second, time.Second)
+	base := &mongoBase{inst: &data.Instance{Name: "lazy"}, conn: &mongodbConnection{breaker: br}, mode: "auto-clear"}
+	netErr := mongo.CommandError{Message: "connection reset", Labels: []string{"NetworkError"}}
+
+	base.setError(netErr)
+	base.setError(data.Error("users.insert", data.ErrValidation, errors.New("bad field")))
+	base.setError(netErr)
+	base.setError(nil)
+	base.setError(netErr)
+	base.setError(netErr)
+	if err := base.ensureAvailable("users.query"); err != nil {
+		t.Fatalf("a success should clear the failure streak, got %v", err)
+	}
+
+	base.setError(topology.ServerSelectionError{Wrapped: topology.ErrServerSelectionTimeout})
+	if err := base.ensureAvailable("users.query"); !errors.Is(err, data.ErrDriver) {
+		t.Fatalf("expected operation errors to open the breaker, got %v", err)
+	}
+	select {
+	case <-br.wake:
+	default:
+		t.Fatalf("expected the probe loop to be woken")
+	}
+
+	base.setError(nil)
+	if open, _, _ := br.state(); !open {
+		t.Fatalf("an operation success must not close an open breaker")
+	}
+}
+
+func TestMongoLazyOpenSkipsPing(t *testing.T) {
+	conn := &mongodbConnection{instance: &data.Instance{Name: "lazy", Config: data.Config{Url: "mongodb://127.0.0.1:1"}, Setting: Map{
+		"lazy": true, "connectTimeout": "5s", "serverSelectionTimeout": "50ms", "reconnectInterval": "1h",
+	}}}
+	started := time.Now()
+	if err := conn.Open(); err != nil {
+		t.Fatalf("lazy open should not fail, got %v", err)
+	}
+	if took := time.Since(started); took > time.Second {
+		t.Fatalf("lazy open should not wait for a ping, took %s", took)
+	}
+	if status := conn.Status(); status.Breaker != "open" || status.Writable {
+		t.Fatalf("lazy connection should start unavailable, got %#v", status)
+	}
+
+	br := conn.breaker
+	if err := conn.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if conn.breaker != br {
+		t.Fatalf("close must keep the breaker pointer for concurrent readers")
+	}
+	if err := (&mongoBase{conn: conn}).ensureAvailable("users.query"); !errors.Is(err, data.ErrDriver) {
+		t.Fatalf("closed lazy connection should stay unavailable, got %v", err)
+	}
+}
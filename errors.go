@@ -0,0 +1,206 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type DuplicateKeyError struct {
+	Index string
+	Keys  Map
+	Err   error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if e.Index == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("duplicate key on index %s: %v", e.Index, e.Err)
+}
+
+func (e *DuplicateKeyError) Unwrap() error { return e.Err }
+
+var mongoDuplicateIndexPattern = regexp.MustCompile(`index: (\S+) dup key`)
+
+var mongoErrorKinds = map[int]error{
+	13:    data.ErrPermission, // Unauthorized
+	18:    data.ErrPermission, // AuthenticationFailed
+	50:    data.ErrTimeout,    // MaxTimeMSExpired
+	91:    data.ErrDriver,     // ShutdownInProgress
+	112:   data.ErrConflict,   // WriteConflict
+	121:   data.ErrValidation, // DocumentValidationFailure
+	189:   data.ErrDriver,     // PrimarySteppedDown
+	262:   data.ErrTimeout,    // ExceededTimeLimit
+	10107: data.ErrDriver,     // NotWritablePrimary
+	10334: data.ErrDriver,     // BSONObjectTooLarge
+	11600: data.ErrDriver,     // InterruptedAtShutdown
+	11602: data.ErrDriver,     // InterruptedDueToReplStateChange
+	13435: data.ErrDriver,     // NotPrimaryNoSecondaryOk
+	13436: data.ErrDriver,     // NotPrimaryOrSecondary
+	17419: data.ErrDriver,     // document exceeds maximum size after update
+}
+
+func isMongoDuplicateCode(code int) bool {
+	switch code {
+	case 11000, 11001, 12582, 16460:
+		return true
+	}
+	return false
+}
+
+func classifyMongoError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *data.DataError
+	if errors.As(err, &de) {
+		return err
+	}
+	if dup := mongoDuplicateKey(err); dup != nil {
+		return data.Error("mongo", data.ErrDuplicate, dup)
+	}
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return data.Error("mongo", data.ErrDuplicate, &DuplicateKeyError{Err: err})
+	case mongo.IsTimeout(err):
+		return data.Error("mongo", data.ErrTimeout, err)
+	case mongo.IsNetworkError(err):
+		return data.Error("mongo", data.ErrDriver, err)
+	case errors.Is(err, context.Canceled):
+		return data.Error("mongo", data.ErrCanceled, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return data.Error("mongo", data.ErrTimeout, err)
+	}
+	for _, code := range mongoErrorCodes(err) {
+		if kind, ok := mongoErrorKinds[code]; ok {
+			return data.Error("mongo", kind, err)
+		}
+	}
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorLabel("TransientTransactionError") {
+		return data.Error("mongo", data.ErrConflict, err)
+	}
+	var we mongo.WriteException
+	if errors.As(err, &we) && we.WriteConcernError != nil {
+		return data.Error("mongo", data.ErrDriver, err)
+	}
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && bwe.WriteConcernError != nil {
+		return data.Error("mongo", data.ErrDriver, err)
+	}
+	return err
+}
+
+func mongoErrorCodes(err error) []int {
+	codes := []int{}
+	var cmd mongo.CommandError
+	if errors.As(err, &cmd) {
+		codes = append(codes, int(cmd.Code))
+	}
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, item := range we.WriteErrors {
+			codes = append(codes, item.Code)
+		}
+		if we.WriteConcernError != nil {
+			codes = append(codes, we.WriteConcernError.Code)
+		}
+	}
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) {
+		for _, item := range bwe.WriteErrors {
+			codes = append(codes, item.Code)
+		}
+		if bwe.WriteConcernError != nil {
+			codes = append(codes, bwe.WriteConcernError.Code)
+		}
+	}
+	return codes
+}
+
+func mongoDuplicateKey(err error) *DuplicateKeyError {
+	msg, raw, found := "", bson.Raw(nil), false
+	var cmd mongo.CommandError
+	if errors.As(err, &cmd) && isMongoDuplicateCode(int(cmd.Code)) {
+		msg, raw, found = cmd.Message, cmd.Raw, true
+	}
+	var we mongo.WriteException
+	if !found && errors.As(err, &we) {
+		for _, item := range we.WriteErrors {
+			if isMongoDuplicateCode(item.Code) {
+				msg, raw, found = item.Message, item.Raw, true
+				break
+			}
+		}
+	}
+	var bwe mongo.BulkWriteException
+	if !found && errors.As(err, &bwe) {
+		for _, item := range bwe.WriteErrors {
+			if isMongoDuplicateCode(item.Code) {
+				msg, raw, found = item.Message, item.Raw, true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	out := &DuplicateKeyError{Err: err}
+	if m := mongoDuplicateIndexPattern.FindStringSubmatch(msg); m != nil {
+		out.Index = m[1]
+	}
+	if len(raw) > 0 {
+		if val, err := raw.LookupErr("keyValue"); err == nil {
+			keys := bson.M{}
+			if doc, ok := val.DocumentOK(); ok && bson.Unmarshal(doc, &keys) == nil {
+				out.Keys = bsonToMap(keys)
+			}
+		}
+	}
+	return out
+}
+
+func mongoInsertErrors(n int, err error, ordered bool) []error {
+	errs := make([]error, n)
+	if err == nil {
+		return errs
+	}
+	// a write concern error says nothing about which rows were written, so it
+	// only reaches the caller through the returned error, never per row
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && len(bwe.WriteErrors) == 0 && bwe.WriteConcernError != nil {
+		return errs
+	}
+	if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+		classified := classifyMongoError(err)
+		for i := range errs {
+			errs[i] = classified
+		}
+		return errs
+	}
+	first := n
+	for _, item := range bwe.WriteErrors {
+		if item.Index < 0 || item.Index >= n {
+			continue
+		}
+		errs[item.Index] = classifyMongoError(mongo.WriteException{WriteErrors: mongo.WriteErrors{item.WriteError}})
+		if item.Index < first {
+			first = item.Index
+		}
+	}
+	if ordered {
+		for i := first + 1; i < n; i++ {
+			if errs[i] == nil {
+				errs[i] = data.Error("insertMany", data.ErrCanceled, fmt.Errorf("not attempted after failure at index %d", first))
+			}
+		}
+	}
+	return errs
+}
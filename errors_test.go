@@ -0,0 +1,103 @@
+package data_mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClassifyMongoErrorKinds(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{mongo.CommandError{Code: 112, Message: "write conflict"}, data.ErrConflict},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121, Message: "Document failed validation"}}}, data.ErrValidation},
+		{mongo.CommandError{Code: 13, Message: "not authorized"}, data.ErrPermission},
+		{mongo.CommandError{Code: 10107, Message: "not primary"}, data.ErrDriver},
+		{mongo.CommandError{Code: 10334, Message: "object too large"}, data.ErrDriver},
+		{mongo.CommandError{Code: 251, Labels: []string{"TransientTransactionError"}}, data.ErrConflict},
+	}
+	for _, c := range cases {
+		if got := classifyMongoError(c.err); !errors.Is(got, c.kind) {
+			t.Fatalf("expected %v for %v, got %v", c.kind, c.err, got)
+		}
+	}
+	plain := errors.New("plain")
+	if got := classifyMongoError(plain); got != plain {
+		t.Fatalf("expected unknown errors passed through, got %v", got)
+	}
+}
+
+func TestClassifyMongoDuplicateKeyDetails(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "index", Value: 0},
+		{Key: "code", Value: 11000},
+		{Key: "keyPattern", Value: bson.D{{Key: "email", Value: 1}}},
+		{Key: "keyValue", Value: bson.D{{Key: "email", Value: "a@example.com"}}},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	src := mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: app.users index: email_1 dup key: { email: "a@example.com" }`,
+		Raw:     raw,
+	}}}
+	got := classifyMongoError(src)
+	if !errors.Is(got, data.ErrDuplicate) {
+		t.Fatalf("expected duplicate classification, got %v", got)
+	}
+	dup, ok := DuplicateKey(got)
+	if !ok {
+		t.Fatalf("expected duplicate key details, got %v", got)
+	}
+	if dup.Index != "email_1" || dup.Keys["email"] != "a@example.com" {
+		t.Fatalf("unexpected duplicate details %#v", dup)
+	}
+	var we mongo.WriteException
+	if !errors.As(got, &we) {
+		t.Fatalf("expected original write exception to stay reachable")
+	}
+}
+
+func TestMongoInsertErrors(t *testing.T) {
+	src := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error collection: app.users index: email_1 dup key: { email: 1 }"}},
+		{WriteError: mongo.WriteError{Index: 3, Code: 121, Message: "Document failed validation"}},
+	}}
+
+	errs := mongoInsertErrors(5, src, false)
+	if errs[0] != nil || errs[2] != nil || errs[4] != nil {
+		t.Fatalf("expected untouched rows to succeed, got %v", errs)
+	}
+	if dup, ok := DuplicateKey(errs[1]); !ok || dup.Index != "email_1" {
+		t.Fatalf("expected duplicate details for row 1, got %v", errs[1])
+	}
+	if !errors.Is(errs[3], data.ErrValidation) {
+		t.Fatalf("expected validation error for row 3, got %v", errs[3])
+	}
+
+	errs = mongoInsertErrors(5, src, true)
+	if errs[0] != nil || !errors.Is(errs[2], data.ErrCanceled) || !errors.Is(errs[4], data.ErrCanceled) {
+		t.Fatalf("expected ordered insert to stop after first failure, got %v", errs)
+	}
+
+	wce := &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}
+	errs = mongoInsertErrors(5, mongo.BulkWriteException{WriteConcernError: wce, WriteErrors: src.WriteErrors}, false)
+	if errs[0] != nil || errs[2] != nil || errs[4] != nil || errs[1] == nil || errs[3] == nil {
+		t.Fatalf("expected write concern error to leave written rows alone, got %v", errs)
+	}
+	errs = mongoInsertErrors(2, mongo.BulkWriteException{WriteConcernError: wce}, false)
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("expected write concern error not to fail rows, got %v", errs)
+	}
+
+	errs = mongoInsertErrors(2, errors.New("network down"), false)
+	if errs[0] == nil || errs[1] == nil {
+		t.Fatalf("expected non-bulk failures to mark every row, got %v", errs)
+	}
+}
@@ -0,0 +1,764 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/infrago/base"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var mongoExecWriteVerbs = map[string]bool{
+	"createindex": true, "dropindex": true, "renamecollection": true,
+	"replaceone": true, "updateone": true, "deleteone": true,
+	"findoneandupdate": true, "findoneanddelete": true, "bulkwrite": true,
+}
+
+var mongoExecResultVerbs = map[string]bool{
+	"distinct": true, "countdocuments": true, "findoneandupdate": true, "findoneanddelete": true,
+}
+
+func mongoVerb(cmd string) string {
+	parts := strings.Fields(strings.ToLower(cmd))
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[0]
+}
+
+func (b *mongoBase) rawVerb(cmd string, args []Any) []Map {
+	if err := b.checkExecVerb(mongoVerb(cmd)); err != nil {
+		b.setError(err)
+		return nil
+	}
+	if mongoExecWriteVerbs[mongoVerb(cmd)] {
+		if err := b.ensureWritable("raw"); err != nil {
+			b.setError(err)
+			return nil
+		}
+	}
+	ctx, cancel := b.opContext(20 * time.Second)
+	defer cancel()
+	rows, _, _, err := b.runExecVerb(ctx, cmd, args)
+	b.setError(err)
+	if err != nil {
+		return nil
+	}
+	return rows
+}
+
+// runExecVerb handles the collection verbs beyond the basic CRUD set shared
+// by Exec and Raw. Rows carry the documents or values a verb returns.
+func (b *mongoBase) runExecVerb(ctx context.Context, cmd string, args []Any) ([]Map, int64, bool, error) {
+	parts := strings.Fields(cmd)
+	if len(parts) == 0 {
+		return nil, 0, false, nil
+	}
+	verb := strings.ToLower(parts[0])
+	switch verb {
+	case "createindex", "dropindex", "renamecollection", "replaceone", "updateone", "deleteone",
+		"findoneandupdate", "findoneanddelete", "distinct", "countdocuments", "bulkwrite":
+	default:
+		return nil, 0, false, nil
+	}
+	if len(parts) < 2 {
+		return nil, 0, true, fmt.Errorf("%s requires collection name", parts[0])
+	}
+	if err := b.ensureAvailable(verb); err != nil {
+		return nil, 0, true, err
+	}
+	coll := b.conn.db.Collection(parts[1])
+	extra := parts[2:]
+
+	switch verb {
+	case "createindex":
+		keys, err := parseMongoIndexKeys(b, firstArg(args))
+		if err != nil {
+			return nil, 0, true, fmt.Errorf("createIndex keys: %w", err)
+		}
+		opts, err := execOptions(args, 1, "name", "unique", "sparse", "expireAfterSeconds", "partialFilterExpression")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		idx := options.Index()
+		if v, ok := opts["name"].(string); ok && v != "" {
+			idx.SetName(v)
+		}
+		if v, ok := parseBool(opts["unique"]); ok {
+			idx.SetUnique(v)
+		}
+		if v, ok := parseBool(opts["sparse"]); ok {
+			idx.SetSparse(v)
+		}
+		if raw, ok := opts["expireAfterSeconds"]; ok {
+			v, ok := parseIntAny(raw)
+			if !ok {
+				return nil, 0, true, fmt.Errorf("createIndex expireAfterSeconds: expected integer, got %v", raw)
+			}
+			idx.SetExpireAfterSeconds(int32(v))
+		}
+		if raw, ok := opts["partialFilterExpression"]; ok {
+			filter, err := b.execFilter(parts[1], raw)
+			if err != nil {
+				return nil, 0, true, err
+			}
+			idx.SetPartialFilterExpression(filter)
+		}
+		name, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: idx})
+		if err != nil {
+			return nil, 0, true, err
+		}
+		return []Map{{"name": name}}, 1, true, nil
+
+	case "dropindex":
+		var target Any
+		if len(extra) > 0 {
+			target = extra[0]
+		} else {
+			target = firstArg(args)
+		}
+		if s, ok := target.(string); ok && strings.TrimSpace(s) == "*" {
+			if _, err := coll.Indexes().DropAll(ctx); err != nil {
+				return nil, 0, true, err
+			}
+			return nil, 1, true, nil
+		}
+		names, err := mongoDropIndexNames(b, target)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		for i, name := range names {
+			_, err = coll.Indexes().DropOne(ctx, name)
+			if err == nil || i == len(names)-1 || !isMongoIndexNotFound(err) {
+				break
+			}
+		}
+		if err != nil {
+			return nil, 0, true, err
+		}
+		return nil, 1, true, nil
+
+	case "renamecollection":
+		to := ""
+		if len(extra) > 0 {
+			to = extra[0]
+		} else if s, ok := firstArg(args).(string); ok {
+			to = strings.TrimSpace(s)
+		}
+		if to == "" {
+			return nil, 0, true, fmt.Errorf("renameCollection requires a target name")
+		}
+		// the admin command takes full namespaces; stay inside this handle's database
+		if strings.Contains(to, ".") {
+			return nil, 0, true, fmt.Errorf("renameCollection target %q must be a collection name in the current database", to)
+		}
+		optIndex := 0
+		if len(extra) == 0 {
+			optIndex = 1
+		}
+		opts, err := execOptions(args, optIndex, "dropTarget")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		dbName := b.conn.db.Name()
+		command := bson.D{{Key: "renameCollection", Value: dbName + "." + parts[1]}, {Key: "to", Value: dbName + "." + to}}
+		if v, ok := parseBool(opts["dropTarget"]); ok {
+			command = append(command, bson.E{Key: "dropTarget", Value: v})
+		}
+		if err := b.conn.client.Database("admin").RunCommand(ctx, command).Err(); err != nil {
+			return nil, 0, true, err
+		}
+		return nil, 1, true, nil
+
+	case "replaceone":
+		filter, err := b.execFilter(parts[1], firstArg(args))
+		if err != nil {
+			return nil, 0, true, err
+		}
+		if len(args) < 2 {
+			return nil, 0, true, fmt.Errorf("replaceOne requires replacement doc")
+		}
+		replacement, err := b.execDocument(args[1])
+		if err != nil {
+			return nil, 0, true, err
+		}
+		opts, err := execOptions(args, 2, "upsert")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		ro := options.Replace()
+		if v, ok := parseBool(opts["upsert"]); ok {
+			ro.SetUpsert(v)
+		}
+		res, err := coll.ReplaceOne(ctx, filter, replacement, ro)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		return nil, res.ModifiedCount + res.UpsertedCount, true, nil
+
+	case "updateone":
+		filter, err := b.execFilter(parts[1], firstArg(args))
+		if err != nil {
+			return nil, 0, true, err
+		}
+		if len(args) < 2 {
+			return nil, 0, true, fmt.Errorf("updateOne requires update doc")
+		}
+		update, err := b.execUpdate(args[1])
+		if err != nil {
+			return nil, 0, true, err
+		}
+		opts, err := execOptions(args, 2, "upsert")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		uo := options.Update()
+		if v, ok := parseBool(opts["upsert"]); ok {
+			uo.SetUpsert(v)
+		}
+		res, err := coll.UpdateOne(ctx, filter, update, uo)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		return nil, res.ModifiedCount + res.UpsertedCount, true, nil
+
+	case "deleteone":
+		filter, err := b.execFilter(parts[1], firstArg(args))
+		if err != nil {
+			return nil, 0, true, err
+		}
+		res, err := coll.DeleteOne(ctx, filter)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		return nil, res.DeletedCount, true, nil
+
+	case "findoneandupdate":
+		filter, err := b.execFilter(parts[1], firstArg(args))
+		if err != nil {
+			return nil, 0, true, err
+		}
+		if len(args) < 2 {
+			return nil, 0, true, fmt.Errorf("findOneAndUpdate requires update doc")
+		}
+		update, err := b.execUpdate(args[1])
+		if err != nil {
+			return nil, 0, true, err
+		}
+		opts, err := execOptions(args, 2, "upsert", "sort", "projection", "returnDocument")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		fo := options.FindOneAndUpdate()
+		if v, ok := parseBool(opts["upsert"]); ok {
+			fo.SetUpsert(v)
+		}
+		if raw, ok := opts["returnDocument"]; ok {
+			switch strings.ToLower(fmt.Sprint(raw)) {
+			case "after":
+				fo.SetReturnDocument(options.After)
+			case "before":
+				fo.SetReturnDocument(options.Before)
+			default:
+				return nil, 0, true, fmt.Errorf("findOneAndUpdate returnDocument: expected before or after, got %v", raw)
+			}
+		}
+		if raw, ok := opts["sort"]; ok {
+			s, err := b.execSort(raw)
+			if err != nil {
+				return nil, 0, true, err
+			}
+			fo.SetSort(s)
+		}
+		if raw, ok := opts["projection"]; ok {
+			p, err := b.execProjection(raw)
+			if err != nil {
+				return nil, 0, true, err
+			}
+			fo.SetProjection(p)
+		}
+		return b.execSingleResult(coll.FindOneAndUpdate(ctx, filter, update, fo))
+
+	case "findoneanddelete":
+		filter, err := b.execFilter(parts[1], firstArg(args))
+		if err != nil {
+			return nil, 0, true, err
+		}
+		opts, err := execOptions(args, 1, "sort", "projection")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		fo := options.FindOneAndDelete()
+		if raw, ok := opts["sort"]; ok {
+			s, err := b.execSort(raw)
+			if err != nil {
+				return nil, 0, true, err
+			}
+			fo.SetSort(s)
+		}
+		if raw, ok := opts["projection"]; ok {
+			p, err := b.execProjection(raw)
+			if err != nil {
+				return nil, 0, true, err
+			}
+			fo.SetProjection(p)
+		}
+		return b.execSingleResult(coll.FindOneAndDelete(ctx, filter, fo))
+
+	case "distinct":
+		if len(extra) == 0 {
+			return nil, 0, true, fmt.Errorf("distinct requires a field name")
+		}
+		filter, err := b.execFilter(parts[1], firstArg(args))
+		if err != nil {
+			return nil, 0, true, err
+		}
+		values, err := coll.Distinct(ctx, b.storageField(extra[0]), filter)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		rows := make([]Map, 0, len(values))
+		for _, one := range values {
+			rows = append(rows, Map{"value": normalizeBsonValue(one)})
+		}
+		return rows, int64(len(values)), true, nil
+
+	case "countdocuments":
+		filter, err := b.execFilter(parts[1], firstArg(args))
+		if err != nil {
+			return nil, 0, true, err
+		}
+		opts, err := execOptions(args, 1, "limit", "skip")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		co := options.Count()
+		if raw, ok := opts["limit"]; ok {
+			n, ok := parseIntAny(raw)
+			if !ok || n < 0 {
+				return nil, 0, true, fmt.Errorf("countDocuments limit: expected non-negative integer, got %v", raw)
+			}
+			co.SetLimit(int64(n))
+		}
+		if raw, ok := opts["skip"]; ok {
+			n, ok := parseIntAny(raw)
+			if !ok || n < 0 {
+				return nil, 0, true, fmt.Errorf("countDocuments skip: expected non-negative integer, got %v", raw)
+			}
+			co.SetSkip(int64(n))
+		}
+		total, err := coll.CountDocuments(ctx, filter, co)
+		if err != nil {
+			return nil, 0, true, err
+		}
+		return []Map{{"count": total}}, total, true, nil
+
+	case "bulkwrite":
+		ops, err := toMapSlice(firstArg(args))
+		if err != nil {
+			return nil, 0, true, fmt.Errorf("bulkWrite requires a list of operations: %w", err)
+		}
+		opts, err := execOptions(args, 1, "ordered")
+		if err != nil {
+			return nil, 0, true, err
+		}
+		models := make([]mongo.WriteModel, 0, len(ops))
+		for i, op := range ops {
+			model, err := b.bulkWriteModel(parts[1], op)
+			if err != nil {
+				return nil, 0, true, fmt.Errorf("bulkWrite operation %d: %w", i, err)
+			}
+			models = append(models, model)
+		}
+		if len(models) == 0 {
+			return nil, 0, true, nil
+		}
+		bo := options.BulkWrite()
+		if v, ok := parseBool(opts["ordered"]); ok {
+			bo.SetOrdered(v)
+		}
+		res, err := coll.BulkWrite(ctx, models, bo)
+		if res == nil {
+			return nil, 0, true, err
+		}
+		return nil, res.InsertedCount + res.ModifiedCount + res.UpsertedCount + res.DeletedCount, true, err
+	}
+	return nil, 0, false, nil
+}
+
+func (b *mongoBase) bulkWriteModel(collection string, op Map) (mongo.WriteModel, error) {
+	if len(op) != 1 {
+		return nil, fmt.Errorf("expected exactly one operation key, got %d", len(op))
+	}
+	for name, raw := range op {
+		spec, ok := raw.(Map)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected Map, got %T", name, raw)
+		}
+		command := map[string]string{
+			"insertone": "insert", "updateone": "update", "updatemany": "update", "replaceone": "update",
+			"deleteone": "delete", "deletemany": "delete",
+		}[strings.ToLower(name)]
+		if command == "" {
+			return nil, fmt.Errorf("unsupported operation %s", name)
+		}
+		if err := b.checkCommand("bulkWrite", command); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(name, "insertone") {
+			doc, err := b.execDocument(spec["document"])
+			if err != nil {
+				return nil, fmt.Errorf("%s document: %w", name, err)
+			}
+			return mongo.NewInsertOneModel().SetDocument(doc), nil
+		}
+		filter, err := b.execFilter(collection, spec["filter"])
+		if err != nil {
+			return nil, fmt.Errorf("%s filter: %w", name, err)
+		}
+		upsert, hasUpsert := parseBool(spec["upsert"])
+		switch strings.ToLower(name) {
+		case "updateone", "updatemany":
+			update, err := b.execUpdate(spec["update"])
+			if err != nil {
+				return nil, fmt.Errorf("%s update: %w", name, err)
+			}
+			if strings.EqualFold(name, "updateone") {
+				model := mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+				if hasUpsert {
+					model.SetUpsert(upsert)
+				}
+				return model, nil
+			}
+			model := mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update)
+			if hasUpsert {
+				model.SetUpsert(upsert)
+			}
+			return model, nil
+		case "replaceone":
+			replacement, err := b.execDocument(spec["replacement"])
+			if err != nil {
+				return nil, fmt.Errorf("%s replacement: %w", name, err)
+			}
+			model := mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement)
+			if hasUpsert {
+				model.SetUpsert(upsert)
+			}
+			return model, nil
+		case "deleteone":
+			return mongo.NewDeleteOneModel().SetFilter(filter), nil
+		case "deletemany":
+			return mongo.NewDeleteManyModel().SetFilter(filter), nil
+		}
+	}
+	return nil, fmt.Errorf("empty operation")
+}
+
+func (b *mongoBase) execSingleResult(res *mongo.SingleResult) ([]Map, int64, bool, error) {
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return []Map{}, 0, true, nil
+		}
+		return nil, 0, true, err
+	}
+	doc := bson.M{}
+	if err := res.Decode(&doc); err != nil {
+		return nil, 0, true, err
+	}
+	return []Map{b.toAppMap(bsonToMap(doc))}, 1, true, nil
+}
+
+// execFilter maps a raw filter like the view query path does: field names
+// per key, recursing into $and/$or/$nor, and key values onto _id.
+func (b *mongoBase) execFilter(collection string, raw Any) (bson.M, error) {
+	filter, err := toBsonMap(raw)
+	if err != nil {
+		return nil, err
+	}
+	return b.execView(collection).mapFilterDoc(filter), nil
+}
+
+// execView describes a collection named by a verb, picking up the table or
+// view config (fields, key, keyAsId) registered for it.
+func (b *mongoBase) execView(collection string) *mongoView {
+	if b.inst != nil {
+		if t, ok := resolveTable(b.inst.Name, collection); ok {
+			return &mongoView{base: b, name: collection, source: pickName(collection, t.Table), key: pickKey(t.Key), fields: t.Fields, keyID: b.settingKeyAsID(t.Setting)}
+		}
+		if v, ok := resolveView(b.inst.Name, collection); ok {
+			return &mongoView{base: b, name: collection, source: pickName(collection, v.View), key: pickKey(v.Key), fields: v.Fields, keyID: b.settingKeyAsID(v.Setting)}
+		}
+	}
+	return &mongoView{base: b, name: collection, source: collection, key: pickKey(""), keyID: b.settingKeyAsID(nil)}
+}
+
+func (v *mongoView) mapFilterDoc(doc bson.M) bson.M {
+	out := bson.M{}
+	for k, val := range doc {
+		switch k {
+		case "$and", "$or", "$nor":
+			out[k] = v.mapFilterList(val)
+			continue
+		}
+		if strings.HasPrefix(k, "$") {
+			out[k] = val
+			continue
+		}
+		field := v.storageField(k)
+		if field == "_id" && v.keyID {
+			val = v.mapKeyOperand(val)
+		}
+		out[field] = val
+	}
+	return out
+}
+
+func (v *mongoView) mapFilterList(raw Any) Any {
+	var items []Any
+	switch vv := raw.(type) {
+	case []Any:
+		items = vv
+	case bson.A:
+		items = vv
+	case []Map:
+		for _, one := range vv {
+			items = append(items, one)
+		}
+	case []bson.M:
+		for _, one := range vv {
+			items = append(items, one)
+		}
+	default:
+		return raw
+	}
+	out := bson.A{}
+	for _, one := range items {
+		if doc, err := toBsonMap(one); err == nil {
+			out = append(out, v.mapFilterDoc(doc))
+		} else {
+			out = append(out, one)
+		}
+	}
+	return out
+}
+
+// mapKeyOperand converts key values in an _id condition, looking inside
+// operator documents such as {$in: [...]} or {$not: {$eq: ...}}.
+func (v *mongoView) mapKeyOperand(val Any) Any {
+	var ops bson.M
+	switch vv := val.(type) {
+	case Map:
+		ops = bson.M(vv)
+	case bson.M:
+		ops = vv
+	default:
+		return v.keyValue(val)
+	}
+	for k := range ops {
+		if !strings.HasPrefix(k, "$") {
+			return val
+		}
+	}
+	out := bson.M{}
+	for k, one := range ops {
+		switch k {
+		case "$in", "$nin", "$all":
+			if list, ok := one.(bson.A); ok {
+				one = []Any(list)
+			}
+			out[k] = v.keyValue(one)
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			out[k] = v.keyValue(one)
+		case "$not":
+			out[k] = v.mapKeyOperand(one)
+		default:
+			out[k] = one
+		}
+	}
+	return out
+}
+
+func (b *mongoBase) execDocument(raw Any) (bson.M, error) {
+	if m, ok := raw.(Map); ok {
+		return bson.M(b.toStorageMap(m)), nil
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("missing document")
+	}
+	return toBsonMap(raw)
+}
+
+func (b *mongoBase) execUpdate(raw Any) (bson.M, error) {
+	if m, ok := raw.(Map); ok {
+		return buildUpdateDoc(b, m), nil
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("missing update doc")
+	}
+	return toBsonMap(raw)
+}
+
+func (b *mongoBase) execSort(raw Any) (bson.D, error) {
+	s, err := parseMongoSort(raw)
+	if err != nil {
+		return nil, fmt.Errorf("sort: %w", err)
+	}
+	for i := range s {
+		s[i].Key = b.storageField(s[i].Key)
+	}
+	return s, nil
+}
+
+func (b *mongoBase) execProjection(raw Any) (bson.D, error) {
+	p, err := parseMongoProjection(raw)
+	if err != nil {
+		return nil, fmt.Errorf("projection: %w", err)
+	}
+	for i := range p {
+		p[i].Key = b.storageField(p[i].Key)
+	}
+	return p, nil
+}
+
+func execOptions(args []Any, index int, allowed ...string) (Map, error) {
+	if len(args) <= index || args[index] == nil {
+		return Map{}, nil
+	}
+	opts, ok := args[index].(Map)
+	if !ok {
+		return nil, fmt.Errorf("invalid options type %T", args[index])
+	}
+	for key := range opts {
+		known := false
+		for _, one := range allowed {
+			if key == one {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// parseMongoIndexKeys accepts "a,-b", "loc:2dsphere", a single-key Map or
+// bson.D; directions may also be index types such as text or hashed.
+func parseMongoIndexKeys(b *mongoBase, raw Any) (bson.D, error) {
+	out := bson.D{}
+	add := func(field string, val Any) error {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return fmt.Errorf("empty field")
+		}
+		if s, ok := val.(string); ok {
+			switch kind := strings.ToLower(strings.TrimSpace(s)); kind {
+			case "text", "hashed", "2d", "2dsphere":
+				out = append(out, bson.E{Key: b.storageField(field), Value: kind})
+				return nil
+			}
+		}
+		dir, err := parseMongoSortDirection(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		out = append(out, bson.E{Key: b.storageField(field), Value: dir})
+		return nil
+	}
+	switch vv := raw.(type) {
+	case bson.D:
+		for _, elem := range vv {
+			if err := add(elem.Key, elem.Value); err != nil {
+				return nil, err
+			}
+		}
+	case Map:
+		if len(vv) != 1 {
+			return nil, fmt.Errorf("a Map has no key order, use bson.D or \"a,-b\" for compound keys")
+		}
+		for k, v := range vv {
+			if err := add(k, v); err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		for _, one := range strings.Split(vv, ",") {
+			one = strings.TrimSpace(one)
+			if one == "" {
+				continue
+			}
+			if field, kind, ok := strings.Cut(one, ":"); ok {
+				if err := add(field, kind); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			dir := int32(1)
+			if strings.HasPrefix(one, "-") {
+				dir = -1
+			}
+			if err := add(strings.TrimLeft(one, "+-"), dir); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %T", raw)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no index keys")
+	}
+	return out, nil
+}
+
+// mongoDropIndexNames lists the index names to try for a dropIndex target.
+// Strings with ",", ":" or a leading sign are key specs; any other string is
+// tried as a name first and then as a single-field key, since "status" may be
+// either.
+func mongoDropIndexNames(b *mongoBase, target Any) ([]string, error) {
+	if name, ok := target.(string); ok {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("dropIndex requires an index name")
+		}
+		if !strings.ContainsAny(name, ",:") && !strings.HasPrefix(name, "-") && !strings.HasPrefix(name, "+") {
+			names := []string{name}
+			if keys, err := parseMongoIndexKeys(b, name); err == nil {
+				if byKeys := mongoIndexName(keys); byKeys != name {
+					names = append(names, byKeys)
+				}
+			}
+			return names, nil
+		}
+	}
+	keys, err := parseMongoIndexKeys(b, target)
+	if err != nil {
+		return nil, fmt.Errorf("dropIndex requires an index name or keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("dropIndex requires an index name")
+	}
+	return []string{mongoIndexName(keys)}, nil
+}
+
+func isMongoIndexNotFound(err error) bool {
+	for _, code := range mongoErrorCodes(err) {
+		if code == 27 {
+			return true
+		}
+	}
+	return false
+}
+
+func mongoIndexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, elem := range keys {
+		parts = append(parts, elem.Key, fmt.Sprint(elem.Value))
+	}
+	return strings.Join(parts, "_")
+}
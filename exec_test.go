@@ -0,0 +1,170 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestParseMongoIndexKeys(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "ledger"}}
+	want := bson.D{{Key: "status", Value: int32(1)}, {Key: "createdAt", Value: int32(-1)}, {Key: "loc", Value: "2dsphere"}}
+	for _, raw := range []Any{
+		"status, -createdAt, loc:2dsphere",
+		bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: "desc"}, {Key: "loc", Value: "2DSphere"}},
+	} {
+		got, err := parseMongoIndexKeys(base, raw)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%v: got %v / %v", raw, got, err)
+		}
+	}
+	if got, err := parseMongoIndexKeys(base, Map{"body": "text"}); err != nil || got[0].Value != "text" {
+		t.Fatalf("expected text index, got %v / %v", got, err)
+	}
+	for _, raw := range []Any{Map{"a": 1, "b": 1}, "", "a:fancy", 3} {
+		if _, err := parseMongoIndexKeys(base, raw); err == nil {
+			t.Fatalf("%v: expected error", raw)
+		}
+	}
+	if name := mongoIndexName(want); name != "status_1_createdAt_-1_loc_2dsphere" {
+		t.Fatalf("unexpected index name %s", name)
+	}
+}
+
+func TestExecOptionsRejectsUnknownKeys(t *testing.T) {
+	if opts, err := execOptions([]Any{Map{}, Map{}, Map{"upsert": true}}, 2, "upsert"); err != nil || opts["upsert"] != true {
+		t.Fatalf("unexpected options %v / %v", opts, err)
+	}
+	if opts, err := execOptions(nil, 1, "upsert"); err != nil || len(opts) != 0 {
+		t.Fatalf("expected empty options, got %v / %v", opts, err)
+	}
+	if _, err := execOptions([]Any{Map{}, Map{"upsrt": true}}, 1, "upsert"); err == nil || !strings.Contains(err.Error(), "upsrt") {
+		t.Fatalf("expected unknown option error, got %v", err)
+	}
+}
+
+func TestExecVerbsReadOnlyAndPolicy(t *testing.T) {
+	readonly := &mongoBase{inst: &data.Instance{Name: "ro", Config: data.Config{ReadOnly: true}}, conn: &mongodbConnection{}, mode: "auto-clear"}
+	for _, cmd := range []string{"createIndex orders", "dropIndex orders status_1", "renameCollection orders archive", "replaceOne orders", "updateOne orders", "deleteOne orders", "findOneAndUpdate orders", "findOneAndDelete orders", "bulkWrite orders"} {
+		readonly.Exec(cmd, Map{})
+		if err := readonly.Error(); !errors.Is(err, data.ErrValidation) {
+			t.Fatalf("%s: expected readonly rejection, got %v", cmd, err)
+		}
+	}
+	readonly.Raw("findOneAndDelete orders", Map{})
+	if err := readonly.Error(); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("raw findOneAndDelete: expected readonly rejection, got %v", err)
+	}
+
+	policy, _ := parseMongoCommandPolicy(Map{"commandDeny": "dropIndexes,delete"})
+	base := &mongoBase{inst: &data.Instance{Name: "svc"}, conn: &mongodbConnection{policy: policy}, mode: "auto-clear"}
+	base.Exec("dropIndex orders status_1")
+	if err := base.Error(); !errors.Is(err, data.ErrPermission) {
+		t.Fatalf("expected dropIndex blocked by policy, got %v", err)
+	}
+	if _, err := base.bulkWriteModel("orders", Map{"deleteOne": Map{"filter": Map{}}}); !errors.Is(err, data.ErrPermission) {
+		t.Fatalf("expected bulk delete blocked by policy, got %v", err)
+	}
+	if _, err := base.bulkWriteModel("orders", Map{"insertOne": Map{"document": Map{"a": 1}}}); err != nil {
+		t.Fatalf("expected bulk insert allowed, got %v", err)
+	}
+}
+
+func TestExecVerbArguments(t *testing.T) {
+	cli := newLazyMongoClient(t)
+	base := &mongoBase{inst: &data.Instance{Name: "local"}, conn: &mongodbConnection{client: cli, db: cli.Database("app")}, mode: "auto-clear"}
+	ctx := context.Background()
+	cases := map[string][]Any{
+		"createIndex":             {Map{"a": 1, "b": 1}},
+		"replaceOne":              {Map{"id": 1}},
+		"updateOne":               {Map{"id": 1}, Map{"a": 1}, Map{"multi": true}},
+		"distinct orders":         {Map{}},
+		"renameCollection orders": nil,
+		"bulkWrite orders":        {[]Map{{"insertOne": Map{"document": Map{}}, "deleteOne": Map{}}}},
+		"countDocuments orders":   {Map{}, Map{"limit": -1}},
+	}
+	for cmd, args := range cases {
+		if !strings.Contains(cmd, " ") {
+			cmd += " orders"
+		}
+		_, _, ok, err := base.runExecVerb(ctx, cmd, args)
+		if !ok || err == nil {
+			t.Fatalf("%s: expected argument error, got handled=%v err=%v", cmd, ok, err)
+		}
+	}
+	if _, _, ok, _ := base.runExecVerb(ctx, "createCollection orders", nil); ok {
+		t.Fatalf("basic verbs must stay with Exec")
+	}
+}
+
+func TestMongoDropIndexNames(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "local"}, mode: "auto-clear"}
+	cases := map[string][]string{
+		"status":            {"status", "status_1"},
+		"status_1":          {"status_1", "status_1_1"},
+		"-createdAt":        {"createdAt_-1"},
+		"status,-createdAt": {"status_1_createdAt_-1"},
+		"location:2dsphere": {"location_2dsphere"},
+	}
+	for target, want := range cases {
+		got, err := mongoDropIndexNames(base, target)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%q: expected %v, got %v (%v)", target, want, got, err)
+		}
+	}
+	if got, err := mongoDropIndexNames(base, bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1}}); err != nil || !reflect.DeepEqual(got, []string{"a_1_b_-1"}) {
+		t.Fatalf("expected keys from bson.D, got %v (%v)", got, err)
+	}
+	if _, err := mongoDropIndexNames(base, " "); err == nil {
+		t.Fatalf("expected empty target to fail")
+	}
+	if !isMongoIndexNotFound(mongo.CommandError{Code: 27, Message: "index not found with name [status]"}) {
+		t.Fatalf("expected code 27 to be index not found")
+	}
+}
+
+func TestMongoExecFilterMapsLikeQueries(t *testing.T) {
+	oid := primitive.NewObjectID()
+	base := &mongoBase{inst: &data.Instance{Name: "local", Config: data.Config{Setting: Map{"keyAsId": true}}}, mode: "auto-clear"}
+	filter, err := base.execFilter("orders", Map{
+		"$or":    []Map{{"id": oid.Hex()}, {"status": "paid"}},
+		"id":     Map{"$in": []Any{oid.Hex()}},
+		"amount": Map{"$gt": 10},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	or, _ := filter["$or"].(bson.A)
+	if len(or) != 2 || or[0].(bson.M)["_id"] != oid || or[1].(bson.M)["status"] != "paid" {
+		t.Fatalf("expected $or branches mapped, got %#v", filter["$or"])
+	}
+	in, _ := filter["_id"].(bson.M)
+	if ids, _ := in["$in"].([]Any); len(ids) != 1 || ids[0] != oid {
+		t.Fatalf("expected $in key values converted, got %#v", filter["_id"])
+	}
+	if _, ok := filter["id"]; ok {
+		t.Fatalf("expected key field moved to _id, got %#v", filter)
+	}
+	if amount, _ := filter["amount"].(Map); amount["$gt"] != 10 {
+		t.Fatalf("expected other operators untouched, got %#v", filter["amount"])
+	}
+}
+
+func TestMongoRenameCollectionStaysInDatabase(t *testing.T) {
+	cli := newLazyMongoClient(t)
+	base := &mongoBase{inst: &data.Instance{Name: "local"}, conn: &mongodbConnection{client: cli, db: cli.Database("app")}, mode: "auto-clear"}
+	for _, cmd := range []string{"renameCollection orders otherdb.orders", "renameCollection orders"} {
+		_, _, ok, err := base.runExecVerb(context.Background(), cmd, []Any{"otherdb.orders"})
+		if !ok || err == nil || !strings.Contains(err.Error(), "current database") {
+			t.Fatalf("%s: expected cross-database rename to be rejected, got %v", cmd, err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package data_mongodb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ExplainQueryPlanner      = "queryPlanner"
+	ExplainExecutionStats    = "executionStats"
+	ExplainAllPlansExecution = "allPlansExecution"
+)
+
+// ExplainOptions can be passed among the Explain and ToPipeline args to pick
+// the verbosity and which read path to translate: query (default), first,
+// slice, count, aggregate or group (Field names the group key).
+type ExplainOptions struct {
+	Verbosity string
+	Op        string
+	Field     string
+}
+
+type ExplainResult struct {
+	Op           string
+	Verbosity    string
+	Collection   string
+	Command      bson.D
+	Filter       bson.M
+	Pipeline     mongo.Pipeline
+	WinningPlan  Map
+	Indexes      []string
+	CollScan     bool
+	KeysExamined int64
+	DocsExamined int64
+	Returned     int64
+	Raw          Map
+}
+
+func (t *mongoTable) Explain(args ...Any) ExplainResult { return (*mongoView)(t).Explain(args...) }
+func (m *mongoModel) Explain(args ...Any) ExplainResult { return m.mongoView.Explain(args...) }
+
+func (v *mongoView) Explain(args ...Any) ExplainResult {
+	res, err := v.explain(args...)
+	v.base.setError(err)
+	return res
+}
+
+func (v *mongoView) explain(args ...Any) (ExplainResult, error) {
+	opts, args := splitExplainOptions(args)
+	verbosity, err := parseExplainVerbosity(opts.Verbosity)
+	if err != nil {
+		return ExplainResult{}, err
+	}
+	tq, err := v.translate(opts.Op, opts.Field, args...)
+	if err != nil {
+		return ExplainResult{}, err
+	}
+	res := ExplainResult{
+		Op: tq.Op, Verbosity: verbosity, Collection: tq.Collection,
+		Command: tq.Command, Filter: tq.Filter, Pipeline: tq.Pipeline,
+	}
+
+	if err := v.base.ensureAvailable(v.name + ".explain"); err != nil {
+		return res, err
+	}
+	// explain is rejected inside multi-document transactions
+	base := v.base.derive()
+	base.tx = nil
+	ctx, cancel := base.opContext(15 * time.Second)
+	defer cancel()
+	runOpts := options.RunCmd()
+	if rp := v.readPref(); rp != nil {
+		runOpts.SetReadPreference(rp)
+	}
+	cmd := bson.D{{Key: "explain", Value: res.Command}, {Key: "verbosity", Value: verbosity}}
+	out := v.base.conn.db.RunCommand(ctx, cmd, runOpts)
+	if err := out.Err(); err != nil {
+		return res, err
+	}
+	raw := bson.M{}
+	if err := out.Decode(&raw); err != nil {
+		return res, err
+	}
+	summarizeMongoExplain(&res, raw)
+	return res, nil
+}
+
+func splitExplainOptions(args []Any) (ExplainOptions, []Any) {
+	opts := ExplainOptions{}
+	rest := make([]Any, 0, len(args))
+	for _, arg := range args {
+		switch vv := arg.(type) {
+		case ExplainOptions:
+			opts = vv
+		case *ExplainOptions:
+			if vv != nil {
+				opts = *vv
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return opts, rest
+}
+
+func parseExplainVerbosity(raw string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", strings.ToLower(ExplainExecutionStats):
+		return ExplainExecutionStats, nil
+	case strings.ToLower(ExplainQueryPlanner):
+		return ExplainQueryPlanner, nil
+	case strings.ToLower(ExplainAllPlansExecution):
+		return ExplainAllPlansExecution, nil
+	}
+	return "", data.Error("explain", data.ErrValidation, fmt.Errorf("invalid explain verbosity %q", raw))
+}
+
+func summarizeMongoExplain(res *ExplainResult, raw bson.M) {
+	res.Raw = bsonToMap(raw)
+	doc := raw
+	if _, ok := raw["queryPlanner"]; !ok {
+		// aggregate explain nests the find layer under the first $cursor stage
+		if stages, ok := explainArray(raw["stages"]); ok && len(stages) > 0 {
+			if first, ok := explainDoc(stages[0]); ok {
+				if cursor, ok := explainDoc(first["$cursor"]); ok {
+					doc = cursor
+				}
+			}
+		}
+	}
+	if planner, ok := explainDoc(doc["queryPlanner"]); ok {
+		if plan, ok := explainDoc(planner["winningPlan"]); ok {
+			if inner, ok := explainDoc(plan["queryPlan"]); ok {
+				plan = inner
+			}
+			res.WinningPlan = bsonToMap(plan)
+			walkExplainPlan(plan, res)
+		}
+	}
+	if stats, ok := explainDoc(doc["executionStats"]); ok {
+		res.Returned = explainInt(stats["nReturned"])
+		res.KeysExamined = explainInt(stats["totalKeysExamined"])
+		res.DocsExamined = explainInt(stats["totalDocsExamined"])
+	}
+}
+
+func walkExplainPlan(plan bson.M, res *ExplainResult) {
+	switch fmt.Sprint(plan["stage"]) {
+	case "IXSCAN", "COUNT_SCAN", "DISTINCT_SCAN":
+		if name, ok := plan["indexName"].(string); ok && name != "" {
+			for _, one := range res.Indexes {
+				if one == name {
+					name = ""
+					break
+				}
+			}
+			if name != "" {
+				res.Indexes = append(res.Indexes, name)
+			}
+		}
+	case "COLLSCAN":
+		res.CollScan = true
+	}
+	if child, ok := explainDoc(plan["inputStage"]); ok {
+		walkExplainPlan(child, res)
+	}
+	if children, ok := explainArray(plan["inputStages"]); ok {
+		for _, one := range children {
+			if child, ok := explainDoc(one); ok {
+				walkExplainPlan(child, res)
+			}
+		}
+	}
+}
+
+func explainDoc(v Any) (bson.M, bool) {
+	switch vv := v.(type) {
+	case bson.M:
+		return vv, true
+	case map[string]any:
+		return bson.M(vv), true
+	case bson.D:
+		out := bson.M{}
+		for _, elem := range vv {
+			out[elem.Key] = elem.Value
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func explainArray(v Any) ([]Any, bool) {
+	switch vv := v.(type) {
+	case bson.A:
+		return []Any(vv), true
+	case []any:
+		return vv, true
+	}
+	return nil, false
+}
+
+func explainInt(v Any) int64 {
+	switch vv := v.(type) {
+	case int32:
+		return int64(vv)
+	case int64:
+		return vv
+	case int:
+		return int64(vv)
+	case float64:
+		return int64(vv)
+	}
+	return 0
+}
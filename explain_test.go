@@ -0,0 +1,95 @@
+package data_mongodb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSummarizeMongoExplainFind(t *testing.T) {
+	raw := bson.M{
+		"queryPlanner": bson.M{
+			"winningPlan": bson.M{
+				"stage": "FETCH",
+				"inputStage": bson.M{
+					"stage": "OR",
+					"inputStages": bson.A{
+						bson.M{"stage": "IXSCAN", "indexName": "status_1"},
+						bson.M{"stage": "IXSCAN", "indexName": "owner_1"},
+						bson.M{"stage": "IXSCAN", "indexName": "status_1"},
+					},
+				},
+			},
+		},
+		"executionStats": bson.M{"nReturned": int32(3), "totalKeysExamined": int32(7), "totalDocsExamined": int64(5)},
+	}
+	res := ExplainResult{}
+	summarizeMongoExplain(&res, raw)
+	if !reflect.DeepEqual(res.Indexes, []string{"status_1", "owner_1"}) || res.CollScan {
+		t.Fatalf("unexpected indexes %v / collscan %v", res.Indexes, res.CollScan)
+	}
+	if res.Returned != 3 || res.KeysExamined != 7 || res.DocsExamined != 5 {
+		t.Fatalf("unexpected stats %+v", res)
+	}
+	if res.WinningPlan["stage"] != "FETCH" || res.Raw == nil {
+		t.Fatalf("expected winning plan and raw output, got %v", res.WinningPlan)
+	}
+}
+
+func TestSummarizeMongoExplainAggregate(t *testing.T) {
+	raw := bson.M{
+		"stages": bson.A{
+			bson.M{"$cursor": bson.M{
+				"queryPlanner":   bson.M{"winningPlan": bson.M{"queryPlan": bson.M{"stage": "COLLSCAN"}}},
+				"executionStats": bson.M{"nReturned": int32(10), "totalDocsExamined": int32(100)},
+			}},
+			bson.M{"$group": bson.M{}},
+		},
+	}
+	res := ExplainResult{}
+	summarizeMongoExplain(&res, raw)
+	if !res.CollScan || len(res.Indexes) != 0 || res.DocsExamined != 100 || res.Returned != 10 {
+		t.Fatalf("unexpected aggregate summary %+v", res)
+	}
+}
+
+func TestExplainOptionsAndCommand(t *testing.T) {
+	opts, rest := splitExplainOptions([]Any{Map{"status": "paid"}, ExplainOptions{Verbosity: "queryplanner", Op: "count"}})
+	if opts.Op != "count" || len(rest) != 1 {
+		t.Fatalf("unexpected split %+v / %v", opts, rest)
+	}
+	if v, err := parseExplainVerbosity(opts.Verbosity); err != nil || v != ExplainQueryPlanner {
+		t.Fatalf("unexpected verbosity %q / %v", v, err)
+	}
+	if v, _ := parseExplainVerbosity(""); v != ExplainExecutionStats {
+		t.Fatalf("expected executionStats by default, got %q", v)
+	}
+	if _, err := parseExplainVerbosity("verbose"); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(10)
+	cmd := findCommandDoc("orders", bson.M{"status": "paid"}, findOpts)
+	keys := []string{}
+	for _, elem := range cmd {
+		keys = append(keys, elem.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"find", "filter", "sort", "limit"}) {
+		t.Fatalf("unexpected find command %v", cmd)
+	}
+
+	view := &mongoView{base: &mongoBase{inst: &data.Instance{Name: "ledger"}, mode: "auto-clear"}, name: "orders", source: "orders", key: "id"}
+	view.Explain(ExplainOptions{Op: "group"})
+	if !errors.Is(view.base.Error(), data.ErrValidation) {
+		t.Fatalf("expected validation error for group without field, got %v", view.base.Error())
+	}
+	view.Explain(ExplainOptions{Op: "distinct"})
+	if !errors.Is(view.base.Error(), data.ErrValidation) {
+		t.Fatalf("expected validation error for unknown op, got %v", view.base.Error())
+	}
+}
@@ -1,6 +1,7 @@
 package data_mongodb
 
 import (
+	"errors"
 	"fmt"
 
 	. "github.com/infrago/base"
@@ -13,6 +14,56 @@ type RawExecutor interface {
 	AggregateRaw(string, Any) []Map
 }
 
+type RawScanner interface {
+	FindRawScan(string, Any, data.ScanFunc, ...Map) Res
+	AggregateRawScan(string, Any, data.ScanFunc) Res
+}
+
+type ReadPreferenceSetter interface {
+	WithReadPreference(Any) data.DataBase
+}
+
+type TxOptionsSetter interface {
+	WithTxOptions(TxOptions) data.DataBase
+}
+
+type TxBeginner interface {
+	BeginTx() (data.DataBase, error)
+}
+
+type SessionRunner interface {
+	Session(data.TxFunc) Res
+}
+
+type BulkInserter interface {
+	InsertManyResults([]Map, bool) []InsertResult
+}
+
+type Explainer interface {
+	Explain(...Any) ExplainResult
+}
+
+type QueryTranslator interface {
+	ToPipeline(...Any) TranslatedQuery
+}
+
+type SequenceAdmin interface {
+	SequenceCurrent(string) (int64, bool, error)
+	SequenceSet(string, int64) error
+	SequenceReset(string) error
+	SequenceList(string) ([]SequenceInfo, error)
+	SequenceDrop(...string) (int64, error)
+}
+
+type SequenceFormatter interface {
+	SequenceBounded(string, int64, int64, int64, bool) (int64, error)
+	SequenceFormat(string, ...SequenceTemplate) (string, error)
+}
+
+type HealthReporter interface {
+	Status() HealthStatus
+}
+
 func AsRawExecutor(db data.DataBase) (RawExecutor, bool) {
 	re, ok := db.(RawExecutor)
 	return re, ok
@@ -42,6 +93,132 @@ func AggregateRaw(db data.DataBase, collection string, pipeline Any) []Map {
 	return re.AggregateRaw(collection, pipeline)
 }
 
+func AsRawScanner(db data.DataBase) (RawScanner, bool) {
+	rs, ok := db.(RawScanner)
+	return rs, ok
+}
+
+func FindRawScan(db data.DataBase, collection string, filter Any, next data.ScanFunc, opts ...Map) Res {
+	rs, ok := AsRawScanner(db)
+	if !ok {
+		return nil
+	}
+	return rs.FindRawScan(collection, filter, next, opts...)
+}
+
+func AggregateRawScan(db data.DataBase, collection string, pipeline Any, next data.ScanFunc) Res {
+	rs, ok := AsRawScanner(db)
+	if !ok {
+		return nil
+	}
+	return rs.AggregateRawScan(collection, pipeline, next)
+}
+
+func WithReadPreference(db data.DataBase, pref Any) data.DataBase {
+	rs, ok := db.(ReadPreferenceSetter)
+	if !ok {
+		return db
+	}
+	return rs.WithReadPreference(pref)
+}
+
+func WithTxOptions(db data.DataBase, opts TxOptions) data.DataBase {
+	ts, ok := db.(TxOptionsSetter)
+	if !ok {
+		return db
+	}
+	return ts.WithTxOptions(opts)
+}
+
+func BeginTx(db data.DataBase) (data.DataBase, error) {
+	tb, ok := db.(TxBeginner)
+	if !ok {
+		if err := db.Begin(); err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	return tb.BeginTx()
+}
+
+func Session(db data.DataBase, fn data.TxFunc) Res {
+	sr, ok := db.(SessionRunner)
+	if !ok {
+		return fn(db)
+	}
+	return sr.Session(fn)
+}
+
+func DuplicateKey(err error) (*DuplicateKeyError, bool) {
+	var dup *DuplicateKeyError
+	if errors.As(err, &dup) {
+		return dup, true
+	}
+	return nil, false
+}
+
+func InsertManyResults(table data.DataTable, items []Map, ordered bool) ([]InsertResult, bool) {
+	bi, ok := table.(BulkInserter)
+	if !ok {
+		return nil, false
+	}
+	return bi.InsertManyResults(items, ordered), true
+}
+
+func Explain(view Any, args ...Any) (ExplainResult, bool) {
+	ex, ok := view.(Explainer)
+	if !ok {
+		return ExplainResult{}, false
+	}
+	return ex.Explain(args...), true
+}
+
+func ToPipeline(view Any, args ...Any) (TranslatedQuery, bool) {
+	qt, ok := view.(QueryTranslator)
+	if !ok {
+		return TranslatedQuery{}, false
+	}
+	return qt.ToPipeline(args...), true
+}
+
+func AsSequenceAdmin(db data.DataBase) (SequenceAdmin, bool) {
+	sa, ok := db.(SequenceAdmin)
+	return sa, ok
+}
+
+func AsSequenceFormatter(db data.DataBase) (SequenceFormatter, bool) {
+	sf, ok := db.(SequenceFormatter)
+	return sf, ok
+}
+
+func SequenceBounded(db data.DataBase, key string, min, max, step int64, cycle bool) (int64, error) {
+	sf, ok := AsSequenceFormatter(db)
+	if !ok {
+		return 0, fmt.Errorf("data db is not mongodb driver")
+	}
+	return sf.SequenceBounded(key, min, max, step, cycle)
+}
+
+func SequenceFormat(db data.DataBase, key string, tpls ...SequenceTemplate) (string, error) {
+	sf, ok := AsSequenceFormatter(db)
+	if !ok {
+		return "", fmt.Errorf("data db is not mongodb driver")
+	}
+	return sf.SequenceFormat(key, tpls...)
+}
+
+func Health(db data.DataBase) (HealthStatus, bool) {
+	hr, ok := db.(HealthReporter)
+	if !ok {
+		return HealthStatus{}, false
+	}
+	return hr.Status(), true
+}
+
+func RegisterCommandHook(hook CommandHook) {
+	registerCommandHook(hook)
+}
+
 func EnsureMongoDriver(db data.DataBase) error {
 	if _, ok := AsRawExecutor(db); !ok {
 		return fmt.Errorf("data db is not mongodb driver")
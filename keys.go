@@ -0,0 +1,351 @@
+package data_mongodb
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	mongoKeyObjectID = "objectid"
+	mongoKeyUUID     = "uuid"
+	mongoKeySequence = "sequence"
+	mongoKeyNone     = "none"
+)
+
+func (b *mongoBase) settingKeyStrategy(name string, setting Map) string {
+	raw, ok := setting["keyStrategy"]
+	if !ok && b.inst != nil {
+		raw, ok = b.inst.Config.Setting["keyStrategy"]
+	}
+	if !ok || raw == nil {
+		return ""
+	}
+	s, _ := raw.(string)
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "", mongoKeyObjectID, mongoKeyUUID, mongoKeySequence, mongoKeyNone:
+		return s
+	}
+	b.setError(data.Error(name+".keyStrategy", data.ErrValidation, fmt.Errorf("unknown key strategy %v", raw)))
+	return ""
+}
+
+func (t *mongoTable) keyMissing(item Map) bool {
+	if t.keyGen == "" || t.keyGen == mongoKeyNone {
+		return false
+	}
+	v, ok := item[t.key]
+	return !ok || v == nil || v == ""
+}
+
+func (t *mongoTable) fillKeys(items []Map) ([]Map, error) {
+	missing := 0
+	for _, item := range items {
+		if t.keyMissing(item) {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return items, nil
+	}
+	var seq []int64
+	if t.keyGen == mongoKeySequence {
+		var err error
+		if missing == 1 {
+			var one int64
+			one, err = t.base.Sequence(t.source, 1, 1)
+			seq = []int64{one}
+		} else {
+			seq, err = t.base.SequenceMany(t.source, int64(missing), 1, 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	out := make([]Map, len(items))
+	for i, item := range items {
+		if !t.keyMissing(item) {
+			out[i] = item
+			continue
+		}
+		m := cloneMap(item)
+		switch t.keyGen {
+		case mongoKeySequence:
+			m[t.key], seq = seq[0], seq[1:]
+		case mongoKeyUUID:
+			id, err := newMongoUUID()
+			if err != nil {
+				return nil, data.Error(t.name+".key", data.ErrDriver, err)
+			}
+			m[t.key] = id
+		default:
+			oid := primitive.NewObjectID()
+			if cfg, ok := t.fields[t.key]; ok && strings.EqualFold(cfg.Type, "string") {
+				m[t.key] = oid.Hex()
+			} else {
+				m[t.key] = oid
+			}
+		}
+		out[i] = m
+	}
+	return out, nil
+}
+
+func (t *mongoTable) newKey() (Any, error) {
+	items, err := t.fillKeys([]Map{{}})
+	if err != nil {
+		return nil, err
+	}
+	return items[0][t.key], nil
+}
+
+func newMongoUUID() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16]), nil
+}
+
+func (b *mongoBase) settingKeyAsID(setting Map) bool {
+	raw, ok := setting["keyAsId"]
+	if !ok && b.inst != nil {
+		raw, ok = b.inst.Config.Setting["keyAsId"]
+	}
+	if !ok {
+		return false
+	}
+	yes, _ := parseBool(raw)
+	return yes
+}
+
+func (v *mongoView) storageField(field string) string {
+	out := v.base.storageField(field)
+	if v.keyID && out == v.base.storageField(v.key) {
+		return "_id"
+	}
+	return out
+}
+
+func (v *mongoView) keyValue(val Any) Any {
+	if !v.keyID {
+		return val
+	}
+	if cfg, ok := v.fields[v.key]; ok && strings.EqualFold(strings.TrimSpace(cfg.Type), "string") {
+		return val
+	}
+	switch vv := val.(type) {
+	case []Any:
+		out := make([]Any, 0, len(vv))
+		for _, one := range vv {
+			out = append(out, normalizeMongoObjectID(one))
+		}
+		return out
+	case []string:
+		out := make([]Any, 0, len(vv))
+		for _, one := range vv {
+			out = append(out, normalizeMongoObjectID(one))
+		}
+		return out
+	}
+	return normalizeMongoObjectID(val)
+}
+
+func (v *mongoView) keyFilter(val Any) bson.M {
+	return bson.M{v.storageField(v.key): v.keyValue(val)}
+}
+
+func (v *mongoView) mapQuery(q data.Query) data.Query {
+	if !v.keyID {
+		q = v.base.mapQueryToStorage(q)
+		q.Joins = v.mapJoinKeys(q.Joins)
+		return q
+	}
+	q = v.base.mapQueryFields(q, v.storageField)
+	if val, ok := q.After["_id"]; ok {
+		q.After["_id"] = v.keyValue(val)
+	}
+	q.Filter = v.mapKeyValues(q.Filter)
+	q.Having = v.mapKeyValues(q.Having)
+	q.Joins = v.mapJoinKeys(q.Joins)
+	return q
+}
+
+// joinView describes the joined table or view, so its keyAsId setting applies
+// to the foreign side of the join.
+func (v *mongoView) joinView(from string) *mongoView {
+	if v.base.inst == nil {
+		return &mongoView{base: v.base, name: from, source: from}
+	}
+	if t, ok := resolveTable(v.base.inst.Name, from); ok {
+		return &mongoView{base: v.base, name: from, source: pickName(from, t.Table), key: pickKey(t.Key), fields: t.Fields, keyID: v.base.settingKeyAsID(t.Setting)}
+	}
+	if vv, ok := resolveView(v.base.inst.Name, from); ok {
+		return &mongoView{base: v.base, name: from, source: pickName(from, vv.View), key: pickKey(vv.Key), fields: vv.Fields, keyID: v.base.settingKeyAsID(vv.Setting)}
+	}
+	return &mongoView{base: v.base, name: from, source: from}
+}
+
+// joinKeyPath maps a join field that names the view's key to _id; bare names
+// only count on the side the join syntax defaults them to.
+func (v *mongoView) joinKeyPath(field string, aliases []string, bare bool) (string, bool) {
+	if !v.keyID {
+		return field, false
+	}
+	key := v.base.storageField(v.key)
+	if bare && field == key {
+		return "_id", true
+	}
+	for _, alias := range aliases {
+		if alias = strings.TrimSpace(alias); alias != "" && field == alias+"."+key {
+			return alias + "._id", true
+		}
+	}
+	return field, false
+}
+
+func (v *mongoView) mapJoinKeys(joins []data.Join) []data.Join {
+	if len(joins) == 0 {
+		return joins
+	}
+	out := make([]data.Join, 0, len(joins))
+	for _, j := range joins {
+		foreign := v.joinView(j.From)
+		alias := strings.TrimSpace(j.Alias)
+		if alias == "" {
+			alias = strings.TrimSpace(j.From)
+		}
+		local := []string{v.name, v.source}
+		remote := []string{alias, j.From}
+		j.LocalField, _ = v.joinKeyPath(j.LocalField, local, true)
+		j.ForeignField, _ = foreign.joinKeyPath(j.ForeignField, remote, true)
+		j.On = v.mapJoinExpr(j.On, foreign, local, remote)
+		out = append(out, j)
+	}
+	return out
+}
+
+// mapJoinExpr follows exprToLookupExpr: a bare compared field is local, bare
+// field refs and exists/null fields are foreign.
+func (v *mongoView) mapJoinExpr(expr data.Expr, foreign *mongoView, local, remote []string) data.Expr {
+	path := func(field string, bareLocal bool) (string, *mongoView) {
+		if out, ok := v.joinKeyPath(field, local, bareLocal); ok {
+			return out, v
+		}
+		if out, ok := foreign.joinKeyPath(field, remote, !bareLocal); ok {
+			return out, foreign
+		}
+		return field, nil
+	}
+	switch e := expr.(type) {
+	case data.AndExpr:
+		items := make([]data.Expr, 0, len(e.Items))
+		for _, one := range e.Items {
+			items = append(items, v.mapJoinExpr(one, foreign, local, remote))
+		}
+		return data.AndExpr{Items: items}
+	case data.OrExpr:
+		items := make([]data.Expr, 0, len(e.Items))
+		for _, one := range e.Items {
+			items = append(items, v.mapJoinExpr(one, foreign, local, remote))
+		}
+		return data.OrExpr{Items: items}
+	case data.NotExpr:
+		return data.NotExpr{Item: v.mapJoinExpr(e.Item, foreign, local, remote)}
+	case data.ExistsExpr:
+		field, _ := path(e.Field, false)
+		return data.ExistsExpr{Field: field, Yes: e.Yes}
+	case data.NullExpr:
+		field, _ := path(e.Field, false)
+		return data.NullExpr{Field: field, Yes: e.Yes}
+	case data.CmpExpr:
+		field, owner := path(e.Field, true)
+		val := e.Value
+		if ref, ok := val.(data.FieldRef); ok {
+			out, _ := path(string(ref), false)
+			val = data.Ref(out)
+		} else if owner != nil {
+			val = owner.keyValue(val)
+		}
+		return data.CmpExpr{Field: field, Op: e.Op, Value: val}
+	}
+	return expr
+}
+
+func (v *mongoView) mapKeyValues(expr data.Expr) data.Expr {
+	switch e := expr.(type) {
+	case data.AndExpr:
+		items := make([]data.Expr, 0, len(e.Items))
+		for _, one := range e.Items {
+			items = append(items, v.mapKeyValues(one))
+		}
+		return data.AndExpr{Items: items}
+	case data.OrExpr:
+		items := make([]data.Expr, 0, len(e.Items))
+		for _, one := range e.Items {
+			items = append(items, v.mapKeyValues(one))
+		}
+		return data.OrExpr{Items: items}
+	case data.NotExpr:
+		return data.NotExpr{Item: v.mapKeyValues(e.Item)}
+	case data.CmpExpr:
+		if e.Field != "_id" {
+			return e
+		}
+		if _, ok := e.Value.(data.FieldRef); ok {
+			return e
+		}
+		return data.CmpExpr{Field: e.Field, Op: e.Op, Value: v.keyValue(e.Value)}
+	}
+	return expr
+}
+
+func (v *mongoView) toStorageMap(input Map) Map {
+	out := v.base.toStorageMapWithFields(input, v.fields)
+	if !v.keyID {
+		return out
+	}
+	key := v.base.storageField(v.key)
+	if val, ok := out[key]; ok {
+		delete(out, key)
+		if val != nil {
+			out["_id"] = v.keyValue(val)
+		}
+	}
+	return out
+}
+
+func (v *mongoView) toAppMap(input Map) Map {
+	if v.keyID {
+		if id, ok := input["_id"]; ok {
+			delete(input, "_id")
+			input[v.base.storageField(v.key)] = id
+		}
+	}
+	return v.base.toAppMap(input)
+}
+
+func (t *mongoTable) storageField(field string) string { return (*mongoView)(t).storageField(field) }
+func (t *mongoTable) keyFilter(val Any) bson.M         { return (*mongoView)(t).keyFilter(val) }
+func (t *mongoTable) mapQuery(q data.Query) data.Query { return (*mongoView)(t).mapQuery(q) }
+func (t *mongoTable) toStorageMap(input Map) Map       { return (*mongoView)(t).toStorageMap(input) }
+
+func (t *mongoTable) updateDoc(payload Map) bson.M {
+	if t.keyID {
+		payload = cloneMap(payload)
+		delete(payload, t.key)
+		if set, ok := payload[UpdSet].(Map); ok {
+			set = cloneMap(set)
+			delete(set, t.key)
+			payload[UpdSet] = set
+		}
+	}
+	return buildUpdateDocWithFields(t.base, payload, t.fields)
+}
@@ -0,0 +1,174 @@
+package data_mongodb
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMongoKeyStrategySetting(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Config: data.Config{Setting: Map{"keyStrategy": "uuid"}}}, mode: "auto-clear"}
+	if got := base.settingKeyStrategy("user", Map{"keyStrategy": "ObjectID"}); got != mongoKeyObjectID {
+		t.Fatalf("expected table setting to win, got %q", got)
+	}
+	if got := base.settingKeyStrategy("user", nil); got != mongoKeyUUID {
+		t.Fatalf("expected instance default, got %q", got)
+	}
+	if got := base.settingKeyStrategy("user", Map{"keyStrategy": "random"}); got != "" || !errors.Is(base.Error(), data.ErrValidation) {
+		t.Fatalf("expected validation error for unknown strategy, got %q", got)
+	}
+}
+
+func TestMongoFillKeys(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	table := &mongoTable{base: &mongoBase{}, name: "user", source: "user", key: "id", keyGen: mongoKeyUUID}
+	in := []Map{{"name": "a"}, {"id": "fixed", "name": "b"}}
+	out, err := table.fillKeys(in)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id, _ := out[0]["id"].(string); !uuidPattern.MatchString(id) {
+		t.Fatalf("expected generated uuid, got %#v", out[0]["id"])
+	}
+	if out[1]["id"] != "fixed" {
+		t.Fatalf("expected caller key kept, got %#v", out[1]["id"])
+	}
+	if _, ok := in[0]["id"]; ok {
+		t.Fatalf("input rows must not be mutated")
+	}
+
+	table.keyGen = mongoKeyObjectID
+	out, _ = table.fillKeys([]Map{{}})
+	if _, ok := out[0]["id"].(primitive.ObjectID); !ok {
+		t.Fatalf("expected object id, got %#v", out[0]["id"])
+	}
+	table.fields = Vars{"id": Var{Type: "string"}}
+	out, _ = table.fillKeys([]Map{{}})
+	if id, _ := out[0]["id"].(string); len(id) != 24 {
+		t.Fatalf("expected hex object id for string keys, got %#v", out[0]["id"])
+	}
+
+	table.keyGen = mongoKeyNone
+	out, _ = table.fillKeys([]Map{{}})
+	if _, ok := out[0]["id"]; ok {
+		t.Fatalf("expected no key with strategy none")
+	}
+}
+
+func TestMongoKeyAsIDMapping(t *testing.T) {
+	oid := primitive.NewObjectID()
+	table := &mongoTable{base: &mongoBase{inst: &data.Instance{}}, name: "user", source: "user", key: "id", keyID: true}
+	view := (*mongoView)(table)
+
+	q := data.Query{Filter: data.AndExpr{Items: []data.Expr{
+		data.CmpExpr{Field: "id", Op: OpEq, Value: oid.Hex()},
+		data.CmpExpr{Field: "name", Op: OpEq, Value: "a"},
+	}}}
+	q.Select = []string{"id", "name"}
+	q.Sort = []data.Sort{{Field: "id"}}
+	q.After = Map{"id": oid.Hex()}
+	q = table.mapQuery(q)
+	if q.Select[0] != "_id" || q.Sort[0].Field != "_id" {
+		t.Fatalf("expected key mapped to _id, got %#v / %#v", q.Select, q.Sort)
+	}
+	if q.After["_id"] != oid {
+		t.Fatalf("expected keyset value converted, got %#v", q.After)
+	}
+	filter, err := exprToFilter(q.Filter)
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+	if got := mongoFilterValue(filter, "_id"); got != oid {
+		t.Fatalf("expected _id filter with object id, got %#v in %#v", got, filter)
+	}
+
+	doc := table.toStorageMap(Map{"id": oid.Hex(), "name": "a"})
+	if _, ok := doc["id"]; ok || doc["_id"] != oid {
+		t.Fatalf("expected key stored as _id, got %#v", doc)
+	}
+	row := view.toAppMap(Map{"_id": oid.Hex(), "name": "a"})
+	if _, ok := row["_id"]; ok || row["id"] != oid.Hex() {
+		t.Fatalf("expected _id returned as key, got %#v", row)
+	}
+	upd := table.updateDoc(Map{"id": oid.Hex(), "name": "b"})
+	if set, _ := upd["$set"].(primitive.M); set["_id"] != nil || set["id"] != nil || set["name"] != "b" {
+		t.Fatalf("expected key stripped from update, got %#v", upd)
+	}
+	if got := table.keyFilter(oid.Hex()); got["_id"] != oid {
+		t.Fatalf("expected key filter on _id, got %#v", got)
+	}
+
+	table.fields = Vars{"id": Var{Type: "string"}}
+	if got := table.keyFilter(oid.Hex()); got["_id"] != oid.Hex() {
+		t.Fatalf("expected string keys kept verbatim, got %#v", got)
+	}
+
+	table.keyID = false
+	if got := table.keyFilter(oid.Hex()); got["id"] != oid.Hex() {
+		t.Fatalf("expected legacy key field without the option, got %#v", got)
+	}
+}
+
+func mongoFilterValue(filter primitive.M, field string) Any {
+	if v, ok := filter[field]; ok {
+		if m, ok := v.(primitive.M); ok {
+			if eq, ok := m["$eq"]; ok {
+				return eq
+			}
+		}
+		return v
+	}
+	for _, key := range []string{"$and", "$or"} {
+		if items, ok := filter[key].([]primitive.M); ok {
+			for _, item := range items {
+				if v := mongoFilterValue(item, field); v != nil {
+					return v
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestMongoKeyAsIDMapsJoinsAndHaving(t *testing.T) {
+	oid := primitive.NewObjectID()
+	view := &mongoView{base: &mongoBase{inst: &data.Instance{}}, name: "user", source: "users", key: "id", keyID: true}
+
+	q := view.mapQuery(data.Query{
+		Having: data.CmpExpr{Field: "id", Op: OpEq, Value: oid.Hex()},
+		Joins: []data.Join{
+			{From: "order", Alias: "o", LocalField: "id", ForeignField: "user_id"},
+			{From: "order", Alias: "o", On: data.AndExpr{Items: []data.Expr{
+				data.CmpExpr{Field: "user.id", Op: OpEq, Value: data.Ref("o.user_id")},
+				data.CmpExpr{Field: "o.user_id", Op: OpEq, Value: data.Ref("users.id")},
+				data.CmpExpr{Field: "id", Op: OpEq, Value: oid.Hex()},
+			}}},
+		},
+	})
+	if cmp, ok := q.Having.(data.CmpExpr); !ok || cmp.Field != "_id" || cmp.Value != oid {
+		t.Fatalf("expected having mapped to _id, got %#v", q.Having)
+	}
+	if q.Joins[0].LocalField != "_id" || q.Joins[0].ForeignField != "user_id" {
+		t.Fatalf("expected local join key mapped to _id, got %#v", q.Joins[0])
+	}
+	on, _ := q.Joins[1].On.(data.AndExpr)
+	want := []data.CmpExpr{
+		{Field: "user._id", Op: OpEq, Value: data.Ref("o.user_id")},
+		{Field: "o.user_id", Op: OpEq, Value: data.Ref("users._id")},
+		{Field: "_id", Op: OpEq, Value: oid},
+	}
+	for i, one := range want {
+		if got, _ := on.Items[i].(data.CmpExpr); got != one {
+			t.Fatalf("join on item %d: expected %#v, got %#v", i, one, on.Items[i])
+		}
+	}
+
+	order := &mongoView{base: view.base, name: "order", source: "orders", key: "id", keyID: true}
+	if got, ok := order.joinKeyPath("o.id", []string{"o", "order"}, true); !ok || got != "o._id" {
+		t.Fatalf("expected foreign key path mapped to _id, got %q", got)
+	}
+}
@@ -0,0 +1,37 @@
+package data_mongodb
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
+
+var mongoLogger = struct {
+	sync.RWMutex
+	out Logger
+}{out: log.New(os.Stderr, "", log.LstdFlags)}
+
+// SetLogger replaces the driver's logger; nil silences it.
+func SetLogger(logger Logger) {
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	mongoLogger.Lock()
+	mongoLogger.out = logger
+	mongoLogger.Unlock()
+}
+
+func mongoLogf(format string, args ...any) {
+	mongoLogger.RLock()
+	out := mongoLogger.out
+	mongoLogger.RUnlock()
+	out.Printf(format, args...)
+}
@@ -20,15 +20,24 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type (
 	mongodbDriver struct{}
 
 	mongodbConnection struct {
-		instance *data.Instance
-		client   *mongo.Client
-		db       *mongo.Database
+		instance          *data.Instance
+		client            *mongo.Client
+		db                *mongo.Database
+		disconnectTimeout time.Duration
+		monitor           *mongoMonitor
+		breaker           *mongoBreaker
+		txMode            string
+		txWarn            sync.Once
+		seqMutex          sync.Mutex
+		seqBlocks         map[string]*mongoSeqBlock
+		policy            *mongoCommandPolicy
 	}
 
 	mongoBase struct {
@@ -39,25 +48,34 @@ type (
 		mode   string
 		ctx    context.Context
 		tmo    time.Duration
-		txCtx  mongo.SessionContext
-		txSes  mongo.Session
-		txDone context.CancelFunc
+		rp     *readpref.ReadPref
+		txOpts *TxOptions
+		tx     *mongoTx
+		sess   mongo.Session
 	}
 
 	mongoTable struct {
-		base   *mongoBase
-		name   string
-		source string
-		key    string
-		fields Vars
+		base    *mongoBase
+		name    string
+		source  string
+		key     string
+		fields  Vars
+		rp      *readpref.ReadPref
+		primary bool
+		keyGen  string
+		keyID   bool
 	}
 
 	mongoView struct {
-		base   *mongoBase
-		name   string
-		source string
-		key    string
-		fields Vars
+		base    *mongoBase
+		name    string
+		source  string
+		key     string
+		fields  Vars
+		rp      *readpref.ReadPref
+		primary bool
+		keyGen  string
+		keyID   bool
 	}
 
 	mongoModel struct {
@@ -193,42 +211,46 @@ func (b *mongoBase) mapQueryToStorage(q data.Query) data.Query {
 	if !b.fieldMappingEnabled() {
 		return q
 	}
+	return b.mapQueryFields(q, b.storageField)
+}
+
+func (b *mongoBase) mapQueryFields(q data.Query, field func(string) string) data.Query {
 	if len(q.Select) > 0 {
 		out := make([]string, 0, len(q.Select))
 		for _, one := range q.Select {
-			out = append(out, b.storageField(one))
+			out = append(out, field(one))
 		}
 		q.Select = out
 	}
 	if len(q.Sort) > 0 {
 		out := make([]data.Sort, 0, len(q.Sort))
 		for _, one := range q.Sort {
-			out = append(out, data.Sort{Field: b.storageField(one.Field), Desc: one.Desc})
+			out = append(out, data.Sort{Field: field(one.Field), Desc: one.Desc})
 		}
 		q.Sort = out
 	}
 	if len(q.Group) > 0 {
 		out := make([]string, 0, len(q.Group))
 		for _, one := range q.Group {
-			out = append(out, b.storageField(one))
+			out = append(out, field(one))
 		}
 		q.Group = out
 	}
 	if len(q.Aggs) > 0 {
 		out := make([]data.Agg, 0, len(q.Aggs))
 		for _, one := range q.Aggs {
-			field := one.Field
-			if field != "*" && field != "" {
-				field = b.storageField(field)
+			name := one.Field
+			if name != "*" && name != "" {
+				name = field(name)
 			}
-			out = append(out, data.Agg{Alias: one.Alias, Op: one.Op, Field: field})
+			out = append(out, data.Agg{Alias: one.Alias, Op: one.Op, Field: name})
 		}
 		q.Aggs = out
 	}
 	if len(q.After) > 0 {
 		after := Map{}
 		for k, v := range q.After {
-			after[b.storageField(k)] = v
+			after[field(k)] = v
 		}
 		q.After = after
 	}
@@ -241,17 +263,17 @@ func (b *mongoBase) mapQueryToStorage(q data.Query) data.Query {
 				Type:         j.Type,
 				LocalField:   b.storageField(j.LocalField),
 				ForeignField: b.storageField(j.ForeignField),
-				On:           b.mapExprToStorage(j.On),
+				On:           b.mapExprFields(j.On, b.storageField),
 			})
 		}
 		q.Joins = out
 	}
-	q.Filter = b.mapExprToStorage(q.Filter)
-	q.Having = b.mapExprToStorage(q.Having)
+	q.Filter = b.mapExprFields(q.Filter, field)
+	q.Having = b.mapExprFields(q.Having, field)
 	return q
 }
 
-func (b *mongoBase) mapExprToStorage(expr data.Expr) data.Expr {
+func (b *mongoBase) mapExprFields(expr data.Expr, field func(string) string) data.Expr {
 	switch e := expr.(type) {
 	case nil:
 		return nil
@@ -260,29 +282,29 @@ func (b *mongoBase) mapExprToStorage(expr data.Expr) data.Expr {
 	case data.AndExpr:
 		items := make([]data.Expr, 0, len(e.Items))
 		for _, one := range e.Items {
-			items = append(items, b.mapExprToStorage(one))
+			items = append(items, b.mapExprFields(one, field))
 		}
 		return data.AndExpr{Items: items}
 	case data.OrExpr:
 		items := make([]data.Expr, 0, len(e.Items))
 		for _, one := range e.Items {
-			items = append(items, b.mapExprToStorage(one))
+			items = append(items, b.mapExprFields(one, field))
 		}
 		return data.OrExpr{Items: items}
 	case data.NotExpr:
-		return data.NotExpr{Item: b.mapExprToStorage(e.Item)}
+		return data.NotExpr{Item: b.mapExprFields(e.Item, field)}
 	case data.ExistsExpr:
-		return data.ExistsExpr{Field: b.storageField(e.Field), Yes: e.Yes}
+		return data.ExistsExpr{Field: field(e.Field), Yes: e.Yes}
 	case data.NullExpr:
-		return data.NullExpr{Field: b.storageField(e.Field), Yes: e.Yes}
+		return data.NullExpr{Field: field(e.Field), Yes: e.Yes}
 	case data.RawExpr:
 		return e
 	case data.CmpExpr:
 		v := e.Value
 		if rf, ok := v.(data.FieldRef); ok {
-			v = data.Ref(b.storageField(string(rf)))
+			v = data.Ref(field(string(rf)))
 		}
-		return data.CmpExpr{Field: b.storageField(e.Field), Op: e.Op, Value: v}
+		return data.CmpExpr{Field: field(e.Field), Op: e.Op, Value: v}
 	default:
 		return e
 	}
@@ -313,25 +335,92 @@ func (c *mongodbConnection) Open() error {
 		dbName = "infrago"
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	clientOpt := options.Client().ApplyURI(dsn)
-	if c.instance.Config.MaxOpen > 0 {
-		clientOpt.SetMaxPoolSize(uint64(c.instance.Config.MaxOpen))
+	clientOpt, err := buildMongoClientOptions(dsn, c.instance.Config, c.instance.Setting)
+	if err != nil {
+		return err
+	}
+	connectTimeout, _, err := mongoSettingDuration(c.instance.Setting, "connectTimeout")
+	if err != nil {
+		return err
 	}
-	if c.instance.Config.MaxIdleTime > 0 {
-		clientOpt.SetMaxConnIdleTime(c.instance.Config.MaxIdleTime)
+	if connectTimeout <= 0 {
+		connectTimeout = mongoDefaultConnectTimeout
+	}
+	disconnectTimeout, _, err := mongoSettingDuration(c.instance.Setting, "disconnectTimeout")
+	if err != nil {
+		return err
+	}
+	if disconnectTimeout <= 0 {
+		disconnectTimeout = mongoDefaultDisconnectTimeout
+	}
+
+	slowThreshold, _, err := mongoSettingDuration(c.instance.Setting, "slowThreshold")
+	if err != nil {
+		return err
+	}
+	txMode, err := parseMongoTxMode(c.instance.Setting)
+	if err != nil {
+		return err
+	}
+	policy, err := parseMongoCommandPolicy(c.instance.Setting)
+	if err != nil {
+		return err
+	}
+	lazy := false
+	if raw, ok := c.instance.Setting["lazy"]; ok {
+		v, yes := parseBool(raw)
+		if !yes {
+			return mongoSettingError("lazy", fmt.Errorf("expected bool, got %v", raw))
+		}
+		lazy = v
+	}
+	var breaker *mongoBreaker
+	if lazy {
+		minWait, _, err := mongoSettingDuration(c.instance.Setting, "reconnectInterval")
+		if err != nil {
+			return err
+		}
+		maxWait, _, err := mongoSettingDuration(c.instance.Setting, "reconnectMaxInterval")
+		if err != nil {
+			return err
+		}
+		breaker = newMongoBreaker(minWait, maxWait, connectTimeout)
 	}
+
+	monitor := newMongoMonitor(c.instance.Name, slowThreshold)
+	clientOpt.SetPoolMonitor(monitor.poolMonitor())
+	clientOpt.SetServerMonitor(monitor.serverMonitor())
+	clientOpt.SetMonitor(monitor.commandMonitor())
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
 	cli, err := mongo.Connect(ctx, clientOpt)
 	if err != nil {
 		return err
 	}
-	if err := cli.Ping(ctx, nil); err != nil {
+	if breaker != nil {
+		// lazy: stay unavailable until the breaker's first probe succeeds
+		breaker.trip(fmt.Errorf("mongodb connection not verified yet"))
+	} else if err := cli.Ping(ctx, nil); err != nil {
 		_ = cli.Disconnect(ctx)
 		return err
 	}
+	// the server monitor has seen the topology by the time Ping succeeds;
+	// otherwise it stays "unknown" and transactions() keeps reading it live
+	if txMode == mongoTxRequire && monitor.status().Topology == "standalone" {
+		_ = cli.Disconnect(ctx)
+		return data.Error("open", data.ErrDriver, fmt.Errorf("mongodb transactions required but server is standalone"))
+	}
 	c.client = cli
 	c.db = cli.Database(dbName)
+	c.disconnectTimeout = disconnectTimeout
+	c.monitor = monitor
+	c.breaker = breaker
+	c.txMode = txMode
+	c.policy = policy
+	if breaker != nil {
+		go breaker.run(cli)
+	}
 	return nil
 }
 
@@ -339,7 +428,14 @@ func (c *mongodbConnection) Close() error {
 	if c.client == nil {
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// keep the pointer: Status and ensureAvailable read it without the lock
+	c.breaker.close()
+	c.releaseSequenceBlocks()
+	timeout := c.disconnectTimeout
+	if timeout <= 0 {
+		timeout = mongoDefaultDisconnectTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	err := c.client.Disconnect(ctx)
 	c.client = nil
@@ -348,7 +444,27 @@ func (c *mongodbConnection) Close() error {
 }
 
 func (c *mongodbConnection) Health() data.Health {
-	return data.Health{Workload: 0}
+	return data.Health{Workload: c.Status().Workload}
+}
+
+func (c *mongodbConnection) Status() HealthStatus {
+	if c == nil || c.client == nil {
+		return HealthStatus{Topology: "unknown"}
+	}
+	status := c.monitor.status()
+	status.Transactions = c.transactions()
+	if c.breaker != nil {
+		open, lastErr, since := c.breaker.state()
+		status.Breaker = "closed"
+		if open {
+			status.Breaker = "open"
+			status.Workload = 100
+			status.Writable = false
+		}
+		status.BreakerSince = since
+		status.LastError = lastErr
+	}
+	return status
 }
 
 func (c *mongodbConnection) DB() *sql.DB { return nil }
@@ -367,94 +483,149 @@ func (mongoDialect) Placeholder(_ int) string { return "?" }
 func (mongoDialect) SupportsILike() bool      { return true }
 func (mongoDialect) SupportsReturning() bool  { return true }
 func (b *mongoBase) Capabilities() data.Capabilities {
-	return data.Capabilities{Dialect: "mongodb", ILike: true, Returning: true, Join: true, Group: true, Having: true, Aggregate: true, KeysetAfter: true, JsonContains: true, ArrayOverlap: true, JsonElemMatch: true}
+	tx := b != nil && b.conn != nil && b.conn.transactions()
+	return data.Capabilities{Dialect: "mongodb", ILike: true, Returning: true, Join: true, Group: true, Having: true, Aggregate: true, KeysetAfter: true, JsonContains: true, ArrayOverlap: true, JsonElemMatch: true, Transactions: tx}
+}
+func (b *mongoBase) Status() HealthStatus {
+	if b == nil || b.conn == nil {
+		return HealthStatus{Topology: "unknown"}
+	}
+	return b.conn.Status()
+}
+func (b *mongoBase) derive() *mongoBase {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return &mongoBase{
+		inst:   b.inst,
+		conn:   b.conn,
+		mode:   b.mode,
+		ctx:    b.ctx,
+		tmo:    b.tmo,
+		rp:     b.rp,
+		txOpts: b.txOpts,
+		tx:     b.tx,
+		sess:   b.sess,
+	}
 }
 func (b *mongoBase) WithContext(ctx context.Context) data.DataBase {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	b.mutex.Lock()
-	b.ctx = ctx
-	b.mutex.Unlock()
-	return b
+	clone := b.derive()
+	clone.ctx = ctx
+	return clone
 }
 func (b *mongoBase) WithTimeout(timeout time.Duration) data.DataBase {
-	b.mutex.Lock()
-	b.tmo = timeout
-	b.mutex.Unlock()
-	return b
+	clone := b.derive()
+	clone.tmo = timeout
+	return clone
+}
+func (b *mongoBase) WithReadPreference(pref Any) data.DataBase {
+	clone := b.derive()
+	rp, err := parseMongoReadPref(pref)
+	if err != nil {
+		clone.setError(data.Error("readPreference", data.ErrValidation, err))
+		return clone
+	}
+	clone.rp = rp
+	return clone
 }
 func (b *mongoBase) Begin() error {
-	b.mutex.RLock()
-	active := b.txCtx != nil
-	b.mutex.RUnlock()
-	if active {
+	if b.inTx() {
 		return nil
 	}
-	ses, err := b.conn.client.StartSession()
+	tx, err := b.startTx()
 	if err != nil {
 		b.setError(err)
 		return err
 	}
-	ctx, cancel := b.txRootContext(10 * time.Second)
-	sc := mongo.NewSessionContext(ctx, ses)
-	if err := sc.StartTransaction(); err != nil {
-		cancel()
-		ses.EndSession(context.Background())
-		b.setError(err)
-		return err
-	}
 	b.mutex.Lock()
-	b.txSes = ses
-	b.txCtx = sc
-	b.txDone = cancel
+	b.tx = tx
 	b.mutex.Unlock()
 	b.setError(nil)
 	return nil
 }
 
+func (b *mongoBase) BeginTx() (data.DataBase, error) {
+	clone := b.derive()
+	if clone.inTx() {
+		return clone, nil
+	}
+	tx, err := clone.startTx()
+	if err != nil {
+		b.setError(err)
+		return nil, err
+	}
+	clone.tx = tx
+	return clone, nil
+}
+
+func (b *mongoBase) startTx() (*mongoTx, error) {
+	if b.conn == nil || b.conn.client == nil {
+		return nil, data.Error("tx.begin", data.ErrDriver, fmt.Errorf("invalid mongodb connection"))
+	}
+	if err := b.ensureAvailable("tx.begin"); err != nil {
+		return nil, err
+	}
+	if !b.conn.transactions() {
+		b.conn.warnNoTx()
+		return nil, nil
+	}
+	txOpts, timeout, err := b.transactionOptions()
+	if err != nil {
+		return nil, err
+	}
+	ses, owned, err := b.session()
+	if err != nil {
+		return nil, err
+	}
+	endSession := func() {
+		if owned {
+			ses.EndSession(context.Background())
+		}
+	}
+	ctx, cancel := b.txRootContext(timeout, mongoDefaultTxTimeout)
+	sc := mongo.NewSessionContext(ctx, ses)
+	if err := sc.StartTransaction(txOpts); err != nil {
+		cancel()
+		endSession()
+		return nil, err
+	}
+	return &mongoTx{ctx: sc, close: func() {
+		endSession()
+		cancel()
+	}}, nil
+}
+
 func (b *mongoBase) Commit() error {
-	b.mutex.RLock()
-	sc := b.txCtx
-	ses := b.txSes
-	b.mutex.RUnlock()
-	if sc == nil || ses == nil {
+	b.mutex.Lock()
+	tx := b.tx
+	b.tx = nil
+	b.mutex.Unlock()
+	sc := tx.sessionContext()
+	if sc == nil {
 		return nil
 	}
 	err := sc.CommitTransaction(sc)
-	ses.EndSession(context.Background())
-	b.mutex.Lock()
-	b.txCtx = nil
-	b.txSes = nil
-	done := b.txDone
-	b.txDone = nil
-	b.mutex.Unlock()
-	if done != nil {
-		done()
+	pending := tx.finish()
+	if err == nil {
+		runTxPending(pending)
 	}
 	b.setError(err)
 	return err
 }
 
 func (b *mongoBase) Rollback() error {
-	b.mutex.RLock()
-	sc := b.txCtx
-	ses := b.txSes
-	b.mutex.RUnlock()
-	if sc == nil || ses == nil {
-		return nil
-	}
-	err := sc.AbortTransaction(sc)
-	ses.EndSession(context.Background())
 	b.mutex.Lock()
-	b.txCtx = nil
-	b.txSes = nil
-	done := b.txDone
-	b.txDone = nil
+	tx := b.tx
+	b.tx = nil
 	b.mutex.Unlock()
-	if done != nil {
-		done()
+	sc := tx.sessionContext()
+	if sc == nil {
+		return nil
 	}
+	err := sc.AbortTransaction(sc)
+	tx.finish()
 	b.setError(err)
 	return err
 }
@@ -463,6 +634,38 @@ func (b *mongoBase) Close() error {
 	return b.Rollback()
 }
 
+func (b *mongoBase) txContext() mongo.SessionContext {
+	b.mutex.RLock()
+	tx := b.tx
+	b.mutex.RUnlock()
+	return tx.sessionContext()
+}
+
+func (b *mongoBase) inTx() bool {
+	return b.txContext() != nil
+}
+
+func (b *mongoBase) afterCommit(fn func()) {
+	b.mutex.RLock()
+	tx := b.tx
+	b.mutex.RUnlock()
+	if tx.enqueue(fn) {
+		return
+	}
+	fn()
+}
+
+func (b *mongoBase) touchTableCache(source string) {
+	name := b.inst.Name
+	b.afterCommit(func() { data.TouchTableCache(name, source) })
+}
+
+func runTxPending(pending []func()) {
+	for _, fn := range pending {
+		fn()
+	}
+}
+
 func txNormalize(res Res) Res {
 	if res == nil {
 		return infra.OK
@@ -494,10 +697,7 @@ func (b *mongoBase) Tx(fn data.TxFunc) Res {
 	if fn == nil {
 		return infra.OK
 	}
-	b.mutex.RLock()
-	hasTx := b.txCtx != nil
-	b.mutex.RUnlock()
-	if hasTx {
+	if b.inTx() {
 		res := txNormalize(fn(b))
 		if res.Fail() {
 			return res
@@ -507,44 +707,64 @@ func (b *mongoBase) Tx(fn data.TxFunc) Res {
 		}
 		return infra.OK
 	}
+	// errors go out through the Res only, never onto the receiver, so
+	// concurrent Tx calls on one base cannot overwrite each other's Error()
 	if b.conn == nil || b.conn.client == nil {
-		err := data.Error("tx.begin", data.ErrDriver, fmt.Errorf("invalid mongodb connection"))
-		b.setError(err)
+		return txErrRes(data.Error("tx.begin", data.ErrDriver, fmt.Errorf("invalid mongodb connection")))
+	}
+	if err := b.ensureAvailable("tx.begin"); err != nil {
 		return txErrRes(err)
 	}
-	ses, err := b.conn.client.StartSession()
+	if !b.conn.transactions() {
+		b.conn.warnNoTx()
+		handle := b.derive()
+		res := txNormalize(fn(handle))
+		if res.Fail() {
+			return res
+		}
+		return txErrRes(handle.Error())
+	}
+	txOpts, timeout, err := b.transactionOptions()
 	if err != nil {
-		b.setError(err)
 		return txErrRes(err)
 	}
-	defer ses.EndSession(context.Background())
-	ctx, cancel := b.txRootContext(10 * time.Second)
+	ses, owned, err := b.session()
+	if err != nil {
+		return txErrRes(err)
+	}
+	if owned {
+		defer ses.EndSession(context.Background())
+	}
+	ctx, cancel := b.txRootContext(timeout, mongoDefaultTxTimeout)
 	defer cancel()
+	handle := b.derive()
 	var final Res = infra.OK
 	_, err = ses.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
-		b.mutex.Lock()
-		b.txSes = ses
-		b.txCtx = sc
-		b.txDone = nil
-		b.mutex.Unlock()
-		b.setError(nil)
-		res := txNormalize(fn(b))
+		handle.mutex.Lock()
+		handle.tx.finish()
+		handle.tx = &mongoTx{ctx: sc}
+		handle.err = nil
+		handle.mutex.Unlock()
+		final = infra.OK
+		res := txNormalize(fn(handle))
 		if res.Fail() {
 			final = res
 			return nil, txResError(res)
 		}
-		if err := b.Error(); err != nil {
+		if err := handle.Error(); err != nil {
 			final = txErrRes(err)
 			return nil, err
 		}
 		return nil, nil
-	})
-	b.mutex.Lock()
-	b.txSes = nil
-	b.txCtx = nil
-	b.txDone = nil
-	b.mutex.Unlock()
-	b.setError(err)
+	}, txOpts)
+	handle.mutex.Lock()
+	tx := handle.tx
+	handle.tx = nil
+	handle.mutex.Unlock()
+	pending := tx.finish()
+	if err == nil && !final.Fail() {
+		runTxPending(pending)
+	}
 	if final.Fail() {
 		return final
 	}
@@ -555,13 +775,8 @@ func (b *mongoBase) TxReadOnly(fn data.TxFunc) Res {
 	if fn == nil {
 		return infra.OK
 	}
-	clone := &mongoBase{
-		conn: b.conn,
-		mode: b.mode,
-		ctx:  b.ctx,
-		tmo:  b.tmo,
-		inst: &data.Instance{},
-	}
+	clone := b.derive()
+	clone.inst = &data.Instance{}
 	if b.inst != nil {
 		*clone.inst = *b.inst
 		clone.inst.Config.ReadOnly = true
@@ -579,14 +794,17 @@ func (b *mongoBase) TxReadOnly(fn data.TxFunc) Res {
 	return clone.Tx(fn)
 }
 func (b *mongoBase) setError(err error) {
+	if err != nil {
+		err = classifyMongoError(err)
+	}
+	if b.conn != nil {
+		b.conn.breaker.record(err)
+	}
 	b.mutex.Lock()
 	if err == nil && b.mode == "sticky" {
 		b.mutex.Unlock()
 		return
 	}
-	if err != nil {
-		err = classifyMongoError(err)
-	}
 	b.err = err
 	b.mutex.Unlock()
 }
@@ -601,65 +819,16 @@ func (b *mongoBase) Error() error {
 }
 func (b *mongoBase) ClearError() { b.setError(nil) }
 
-func classifyMongoError(err error) error {
-	if err == nil {
-		return nil
-	}
-	var de *data.DataError
-	if errors.As(err, &de) {
-		return err
-	}
-	switch {
-	case mongo.IsDuplicateKeyError(err):
-		return data.Error("mongo", data.ErrDuplicate, err)
-	case mongo.IsTimeout(err):
-		return data.Error("mongo", data.ErrTimeout, err)
-	case mongo.IsNetworkError(err):
-		return data.Error("mongo", data.ErrDriver, err)
-	case errors.Is(err, context.Canceled):
-		return data.Error("mongo", data.ErrCanceled, err)
-	case errors.Is(err, context.DeadlineExceeded):
-		return data.Error("mongo", data.ErrTimeout, err)
-	}
-	var cmd mongo.CommandError
-	if errors.As(err, &cmd) {
-		switch cmd.Code {
-		case 50:
-			return data.Error("mongo", data.ErrTimeout, err)
-		case 11000, 11001, 12582, 16460:
-			return data.Error("mongo", data.ErrDuplicate, err)
-		case 11600, 11602, 13435, 13436:
-			return data.Error("mongo", data.ErrDriver, err)
-		}
-	}
-	var we mongo.WriteException
-	if errors.As(err, &we) {
-		for _, item := range we.WriteErrors {
-			switch item.Code {
-			case 11000, 11001, 12582, 16460:
-				return data.Error("mongo", data.ErrDuplicate, err)
-			}
-		}
-		if we.WriteConcernError != nil {
-			return data.Error("mongo", data.ErrDriver, err)
-		}
+func (b *mongoBase) Sequence(key string, offset, step int64) (int64, error) {
+	key = strings.TrimSpace(key)
+	size, err := b.sequenceBlockSize(key)
+	if err != nil {
+		b.setError(err)
+		return 0, err
 	}
-	var bwe mongo.BulkWriteException
-	if errors.As(err, &bwe) {
-		for _, item := range bwe.WriteErrors {
-			switch item.Code {
-			case 11000, 11001, 12582, 16460:
-				return data.Error("mongo", data.ErrDuplicate, err)
-			}
-		}
-		if bwe.WriteConcernError != nil {
-			return data.Error("mongo", data.ErrDriver, err)
-		}
+	if size > 1 && key != "" && b.conn != nil {
+		return b.sequenceFromBlock(key, size, offset, step)
 	}
-	return err
-}
-
-func (b *mongoBase) Sequence(key string, offset, step int64) (int64, error) {
 	items, err := b.SequenceMany(key, 1, offset, step)
 	if err != nil {
 		return 0, err
@@ -744,16 +913,19 @@ func (b *mongoBase) SequenceMany(key string, count, offset, step int64) ([]int64
 }
 
 func (b *mongoBase) opContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	sc := b.txContext()
 	b.mutex.RLock()
-	sc := b.txCtx
 	base := b.ctx
 	tmo := b.tmo
+	ses := b.sess
 	b.mutex.RUnlock()
 	if base == nil {
 		base = context.Background()
 	}
 	if sc != nil {
 		base = sc
+	} else if ses != nil {
+		base = mongo.NewSessionContext(base, ses)
 	}
 	if tmo > 0 {
 		timeout = tmo
@@ -838,14 +1010,19 @@ func mergeMongoExpr(left, right data.Expr) data.Expr {
 	return data.AndExpr{Items: []data.Expr{left, right}}
 }
 
-func (b *mongoBase) txRootContext(defaultTimeout time.Duration) (context.Context, context.CancelFunc) {
+// txRootContext picks the first positive of timeout (TxOptions / tx* settings),
+// the handle timeout and defaultTimeout.
+func (b *mongoBase) txRootContext(timeout, defaultTimeout time.Duration) (context.Context, context.CancelFunc) {
 	b.mutex.RLock()
 	base := b.ctx
-	timeout := b.tmo
+	tmo := b.tmo
 	b.mutex.RUnlock()
 	if base == nil {
 		base = context.Background()
 	}
+	if timeout <= 0 {
+		timeout = tmo
+	}
 	if timeout <= 0 {
 		timeout = defaultTimeout
 	}
@@ -896,6 +1073,8 @@ func (b *mongoBase) Raw(query string, args ...Any) []Map {
 			}
 		}
 		return b.FindRaw(parts[1], firstArg(args))
+	case mongoExecResultVerbs[mongoVerb(cmd)]:
+		return b.rawVerb(cmd, args)
 	default:
 		command, err := parseCommand(query, firstArg(args))
 		if err != nil {
@@ -903,7 +1082,7 @@ func (b *mongoBase) Raw(query string, args ...Any) []Map {
 			return nil
 		}
 		row := b.Command(command)
-		if b.Error() != nil || row == nil {
+		if row == nil {
 			return nil
 		}
 		return []Map{row}
@@ -912,6 +1091,12 @@ func (b *mongoBase) Raw(query string, args ...Any) []Map {
 func (b *mongoBase) Exec(query string, args ...Any) int64 {
 	cmd := strings.TrimSpace(query)
 	lower := strings.ToLower(cmd)
+	if parts := strings.Fields(lower); len(parts) > 0 {
+		if err := b.checkExecVerb(parts[0]); err != nil {
+			b.setError(err)
+			return 0
+		}
+	}
 	if isWriteMongoCommand(lower) {
 		if err := b.ensureWritable("exec"); err != nil {
 			b.setError(err)
@@ -1010,25 +1195,43 @@ func (b *mongoBase) Exec(query string, args ...Any) int64 {
 			b.setError(err)
 			return 0
 		}
+		if len(rows) == 0 {
+			b.setError(nil)
+			return 0
+		}
+		ordered := true
+		if len(args) > 1 {
+			if opts, ok := args[1].(Map); ok {
+				if vv, ok := parseBool(opts["ordered"]); ok {
+					ordered = vv
+				}
+			}
+		}
 		docs := make([]any, 0, len(rows))
 		for _, row := range rows {
 			docs = append(docs, bson.M(b.toStorageMap(row)))
 		}
-		res, err := b.conn.db.Collection(parts[1]).InsertMany(ctx, docs)
-		if err != nil {
-			b.setError(err)
-			return 0
+		_, err = b.conn.db.Collection(parts[1]).InsertMany(ctx, docs, options.InsertMany().SetOrdered(ordered))
+		count := int64(0)
+		for _, one := range mongoInsertErrors(len(docs), err, ordered) {
+			if one == nil {
+				count++
+			}
 		}
-		b.setError(nil)
-		return int64(len(res.InsertedIDs))
+		b.setError(err)
+		return count
 	default:
+		if _, n, ok, err := b.runExecVerb(ctx, cmd, args); ok {
+			b.setError(err)
+			return n
+		}
 		command, err := parseCommand(query, firstArg(args))
 		if err != nil {
 			b.setError(err)
 			return 0
 		}
 		row := b.Command(command)
-		if b.Error() != nil || row == nil {
+		if row == nil {
 			return 0
 		}
 		return 1
@@ -1042,7 +1245,7 @@ func (b *mongoBase) ensureWritable(op string) error {
 	if b.inst.Config.ReadOnly || isReadOnlyMongoSetting(b.inst.Config.Setting) {
 		return data.Error(op, data.ErrValidation, fmt.Errorf("readonly data connection: %s", b.inst.Name))
 	}
-	return nil
+	return b.ensureAvailable(op)
 }
 
 func isReadOnlyMongoSetting(setting Map) bool {
@@ -1068,16 +1271,80 @@ func isWriteMongoCommand(cmd string) bool {
 		strings.HasPrefix(cmd, "insertmany "):
 		return true
 	default:
+		return mongoExecWriteVerbs[mongoVerb(cmd)]
+	}
+}
+
+// mongoReadCommands lists the commands a read-only handle may run; anything
+// else (user/role admin, shutdown, fsync, ...) counts as a write.
+var mongoReadCommands = map[string]bool{
+	"find": true, "count": true, "distinct": true, "getmore": true, "killcursors": true,
+	"listcollections": true, "listindexes": true, "listdatabases": true, "listsearchindexes": true,
+	"dbstats": true, "collstats": true, "datasize": true, "dbhash": true, "validate": true, "explain": true,
+	"ping": true, "hello": true, "ismaster": true, "buildinfo": true, "serverstatus": true, "hostinfo": true,
+	"connectionstatus": true, "currentop": true, "getparameter": true, "getlog": true, "getcmdlineopts": true,
+	"replsetgetstatus": true, "top": true, "usersinfo": true, "rolesinfo": true, "whatsmyuri": true,
+}
+
+func isWriteMongoCommandDoc(cmd bson.D) bool {
+	if len(cmd) == 0 {
 		return false
 	}
+	name := strings.ToLower(cmd[0].Key)
+	switch name {
+	case "aggregate":
+		for _, elem := range cmd[1:] {
+			if elem.Key != "pipeline" {
+				continue
+			}
+			pipeline, err := parsePipelineArg(elem.Value)
+			// an unreadable pipeline cannot be proven read-only
+			return err != nil || isWriteMongoPipeline(pipeline)
+		}
+	case "mapreduce":
+		for _, elem := range cmd[1:] {
+			if elem.Key != "out" {
+				continue
+			}
+			out, err := toBsonDoc(elem.Value)
+			return err != nil || len(out) == 0 || out[0].Key != "inline"
+		}
+		return true
+	}
+	return !mongoReadCommands[name]
+}
+
+func isWriteMongoPipeline(pipeline mongo.Pipeline) bool {
+	for _, stage := range pipeline {
+		for _, elem := range stage {
+			if elem.Key == "$out" || elem.Key == "$merge" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (b *mongoBase) Command(cmd Any) Map {
+	if err := b.ensureAvailable("command"); err != nil {
+		b.setError(err)
+		return nil
+	}
 	command, err := parseCommand("command", cmd)
 	if err != nil {
 		b.setError(err)
 		return nil
 	}
+	if err := b.checkCommandDoc(command); err != nil {
+		b.setError(err)
+		return nil
+	}
+	if isWriteMongoCommandDoc(command) {
+		if err := b.ensureWritable("command"); err != nil {
+			b.setError(err)
+			return nil
+		}
+	}
 	ctx, cancel := b.opContext(20 * time.Second)
 	defer cancel()
 	res := b.conn.db.RunCommand(ctx, command)
@@ -1095,57 +1362,13 @@ func (b *mongoBase) Command(cmd Any) Map {
 }
 
 func (b *mongoBase) FindRaw(collection string, filter Any, opts ...Map) []Map {
-	f, err := toBsonMap(filter)
-	if err != nil {
-		b.setError(err)
-		return nil
-	}
-	findOpts := options.Find()
-	if len(opts) > 0 {
-		m := opts[0]
-		if sorts, ok := m["sort"].(Map); ok {
-			sd := bson.D{}
-			for k, v := range sorts {
-				dir := int32(1)
-				switch vv := v.(type) {
-				case int:
-					if vv < 0 {
-						dir = -1
-					}
-				case int64:
-					if vv < 0 {
-						dir = -1
-					}
-				}
-				sd = append(sd, bson.E{Key: k, Value: dir})
-			}
-			findOpts.SetSort(sd)
-		}
-		if lim, ok := parseInt64(m["limit"]); ok && lim > 0 {
-			findOpts.SetLimit(lim)
-		}
-		if off, ok := parseInt64(m["offset"]); ok && off > 0 {
-			findOpts.SetSkip(off)
-		}
-	}
 	ctx, cancel := b.opContext(20 * time.Second)
 	defer cancel()
-	cur, err := b.conn.db.Collection(collection).Find(ctx, f, findOpts)
-	if err != nil {
-		b.setError(err)
-		return nil
-	}
-	defer cur.Close(ctx)
 	out := make([]Map, 0)
-	for cur.Next(ctx) {
-		row := bson.M{}
-		if err := cur.Decode(&row); err != nil {
-			b.setError(err)
-			return nil
-		}
-		out = append(out, bsonToMap(row))
-	}
-	if err := cur.Err(); err != nil {
+	if _, err := b.findRaw(ctx, collection, filter, opts, func(row Map) Res {
+		out = append(out, row)
+		return nil
+	}); err != nil {
 		b.setError(err)
 		return nil
 	}
@@ -1154,29 +1377,13 @@ func (b *mongoBase) FindRaw(collection string, filter Any, opts ...Map) []Map {
 }
 
 func (b *mongoBase) AggregateRaw(collection string, pipeline Any) []Map {
-	pipe, err := parsePipelineArg(pipeline)
-	if err != nil {
-		b.setError(err)
-		return nil
-	}
 	ctx, cancel := b.opContext(20 * time.Second)
 	defer cancel()
-	cur, err := b.conn.db.Collection(collection).Aggregate(ctx, pipe)
-	if err != nil {
-		b.setError(err)
-		return nil
-	}
-	defer cur.Close(ctx)
 	out := make([]Map, 0)
-	for cur.Next(ctx) {
-		row := bson.M{}
-		if err := cur.Decode(&row); err != nil {
-			b.setError(err)
-			return nil
-		}
-		out = append(out, bsonToMap(row))
-	}
-	if err := cur.Err(); err != nil {
+	if _, err := b.aggregateRaw(ctx, collection, pipeline, func(row Map) Res {
+		out = append(out, row)
+		return nil
+	}); err != nil {
 		b.setError(err)
 		return nil
 	}
@@ -1613,7 +1820,7 @@ func (b *mongoBase) ensureSequenceCollection() error {
 		return nil
 	}
 
-	ctx, cancel := b.txRootContext(10 * time.Second)
+	ctx, cancel := b.txRootContext(0, 10*time.Second)
 	defer cancel()
 
 	if err := b.ensureCollection(ctx, mongoSequenceCollection); err != nil {
@@ -1809,7 +2016,7 @@ func (b *mongoBase) Table(name string) data.DataTable {
 		b.setError(fmt.Errorf("data table not found: %s", name))
 		return &mongoTable{base: b, name: name, source: name, key: "id"}
 	}
-	return &mongoTable{base: b, name: name, source: pickName(name, t.Table), key: pickKey(t.Key), fields: t.Fields}
+	return &mongoTable{base: b, name: name, source: pickName(name, t.Table), key: pickKey(t.Key), fields: t.Fields, rp: b.settingReadPref(name, t.Setting), keyGen: b.settingKeyStrategy(name, t.Setting), keyID: b.settingKeyAsID(t.Setting)}
 }
 
 func (b *mongoBase) View(name string) data.DataView {
@@ -1818,7 +2025,7 @@ func (b *mongoBase) View(name string) data.DataView {
 		b.setError(fmt.Errorf("data view not found: %s", name))
 		return &mongoView{base: b, name: name, source: name, key: "id"}
 	}
-	return &mongoView{base: b, name: name, source: pickName(name, v.View), key: pickKey(v.Key), fields: v.Fields}
+	return &mongoView{base: b, name: name, source: pickName(name, v.View), key: pickKey(v.Key), fields: v.Fields, rp: b.settingReadPref(name, v.Setting), keyID: b.settingKeyAsID(v.Setting)}
 }
 
 func (b *mongoBase) Model(name string) data.DataModel {
@@ -1827,19 +2034,47 @@ func (b *mongoBase) Model(name string) data.DataModel {
 		b.setError(fmt.Errorf("data model not found: %s", name))
 		return &mongoModel{mongoView{base: b, name: name, source: name, key: "id"}}
 	}
-	return &mongoModel{mongoView{base: b, name: name, source: pickName(name, m.Model), key: pickKey(m.Key), fields: m.Fields}}
+	return &mongoModel{mongoView{base: b, name: name, source: pickName(name, m.Model), key: pickKey(m.Key), fields: m.Fields, keyID: b.settingKeyAsID(nil)}}
+}
+
+func (b *mongoBase) settingReadPref(name string, setting Map) *readpref.ReadPref {
+	if setting == nil {
+		return nil
+	}
+	raw, ok := setting["readPreference"]
+	if !ok || raw == nil {
+		return nil
+	}
+	rp, err := parseMongoReadPref(raw)
+	if err != nil {
+		b.setError(data.Error(name+".readPreference", data.ErrValidation, err))
+		return nil
+	}
+	return rp
 }
 
 func (t *mongoTable) coll() *mongo.Collection { return t.base.conn.db.Collection(t.source) }
 
+func (t *mongoTable) writeView() *mongoView {
+	v := *(*mongoView)(t)
+	v.primary = true
+	return &v
+}
+
 func (t *mongoTable) Insert(dataIn Map) Map {
 	if err := t.base.ensureWritable(t.name + ".insert"); err != nil {
 		t.base.setError(err)
 		return nil
 	}
+	filled, err := t.fillKeys([]Map{dataIn})
+	if err != nil {
+		t.base.setError(err)
+		return nil
+	}
+	dataIn = filled[0]
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
-	doc := bson.M(t.base.toStorageMapWithFields(dataIn, t.fields))
+	doc := bson.M(t.toStorageMap(dataIn))
 	res, err := t.coll().InsertOne(ctx, doc)
 	if err != nil {
 		t.base.setError(err)
@@ -1850,59 +2085,101 @@ func (t *mongoTable) Insert(dataIn Map) Map {
 		out[t.key] = res.InsertedID
 	}
 	if out[t.key] != nil {
-		if entity := t.First(Map{t.key: out[t.key]}); t.base.Error() == nil && entity != nil {
+		if entity := t.writeView().First(Map{t.key: out[t.key]}); t.base.Error() == nil && entity != nil {
 			out = entity
 		} else {
 			t.base.setError(nil)
 		}
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
+	t.base.touchTableCache(t.source)
 	keys := []Any(nil)
 	if t.base.watcherKeysEnabled() && out[t.key] != nil {
 		keys = []Any{out[t.key]}
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationInsert, 1, out[t.key], keys, out, nil)
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationInsert, 1, out[t.key], keys, out, nil)
+	})
 	t.base.setError(nil)
 	return out
 }
 
+type InsertResult struct {
+	Index int
+	Key   Any
+	Item  Map
+	Err   error
+}
+
 func (t *mongoTable) InsertMany(items []Map) []Map {
-	if err := t.base.ensureWritable(t.name + ".insertMany"); err != nil {
+	results, err := t.insertMany(items, true)
+	if err != nil {
 		t.base.setError(err)
 		return nil
 	}
+	out := make([]Map, 0, len(results))
+	for _, item := range results {
+		out = append(out, item.Item)
+	}
+	t.base.setError(nil)
+	return out
+}
+
+func (t *mongoTable) InsertManyResults(items []Map, ordered bool) []InsertResult {
+	results, err := t.insertMany(items, ordered)
+	t.base.setError(err)
+	return results
+}
+
+func (t *mongoTable) insertMany(items []Map, ordered bool) ([]InsertResult, error) {
+	if err := t.base.ensureWritable(t.name + ".insertMany"); err != nil {
+		return nil, err
+	}
 	if len(items) == 0 {
-		t.base.setError(nil)
-		return []Map{}
+		return []InsertResult{}, nil
+	}
+	items, err := t.fillKeys(items)
+	if err != nil {
+		return nil, err
 	}
 	ctx, cancel := t.base.opContext(15 * time.Second)
 	defer cancel()
 	docs := make([]any, 0, len(items))
 	for _, item := range items {
-		docs = append(docs, bson.M(t.base.toStorageMapWithFields(item, t.fields)))
+		docs = append(docs, bson.M(t.toStorageMap(item)))
 	}
-	res, err := t.coll().InsertMany(ctx, docs)
-	if err != nil {
-		t.base.setError(err)
-		return nil
+	res, err := t.coll().InsertMany(ctx, docs, options.InsertMany().SetOrdered(ordered))
+	var ids []any
+	if res != nil {
+		ids = res.InsertedIDs
 	}
-	out := make([]Map, 0, len(items))
+	errs := mongoInsertErrors(len(items), err, ordered)
+	results := make([]InsertResult, len(items))
+	inserted := make([]Map, 0, len(items))
 	for i, item := range items {
-		m := cloneMap(item)
-		if _, ok := m[t.key]; !ok && i < len(res.InsertedIDs) {
-			m[t.key] = res.InsertedIDs[i]
+		results[i] = InsertResult{Index: i, Err: errs[i]}
+		if errs[i] != nil {
+			continue
 		}
-		out = append(out, m)
-	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
-	keys := t.collectKeys(out)
-	var key Any
-	if len(keys) > 0 {
-		key = keys[0]
+		m := cloneMap(item)
+		if _, ok := m[t.key]; !ok && i < len(ids) {
+			m[t.key] = ids[i]
+		}
+		results[i].Key = m[t.key]
+		results[i].Item = m
+		inserted = append(inserted, m)
+	}
+	if len(inserted) > 0 {
+		t.base.touchTableCache(t.source)
+		keys := t.collectKeys(inserted)
+		var key Any
+		if len(keys) > 0 {
+			key = keys[0]
+		}
+		t.base.afterCommit(func() {
+			data.EmitMutation(t.base.inst.Name, t.source, data.MutationInsert, int64(len(inserted)), key, keys, nil, nil)
+		})
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationInsert, int64(len(out)), key, keys, nil, nil)
-	t.base.setError(nil)
-	return out
+	return results, err
 }
 
 func (t *mongoTable) Upsert(dataIn Map, args ...Any) Map {
@@ -1914,15 +2191,18 @@ func (t *mongoTable) Upsert(dataIn Map, args ...Any) Map {
 	if len(args) > 0 {
 		if m, ok := args[0].(Map); ok {
 			for k, v := range m {
-				filter[t.base.storageField(k)] = v
+				filter[t.storageField(k)] = v
 			}
 		}
 	}
 	if len(filter) == 0 {
 		if id, ok := dataIn[t.key]; ok {
-			filter[t.base.storageField(t.key)] = id
+			filter[t.storageField(t.key)] = id
 		}
 	}
+	if val, ok := filter["_id"]; ok && t.keyID {
+		filter["_id"] = (*mongoView)(t).keyValue(val)
+	}
 	if len(filter) == 0 {
 		out := t.Insert(dataIn)
 		if t.base.Error() == nil && out != nil {
@@ -1930,27 +2210,62 @@ func (t *mongoTable) Upsert(dataIn Map, args ...Any) Map {
 			if t.base.watcherKeysEnabled() && out[t.key] != nil {
 				keys = []Any{out[t.key]}
 			}
-			data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpsert, 1, out[t.key], keys, nil, filter)
+			t.base.afterCommit(func() {
+				data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpsert, 1, out[t.key], keys, nil, filter)
+			})
 		}
 		return out
 	}
 	payload := t.withAutoUpdateStamp(dataIn)
-	upd := buildUpdateDocWithFields(t.base, payload, t.fields)
+	upd := t.updateDoc(payload)
+	setOnInsertKey := func(key Any) {
+		insert := bson.M{}
+		if prev, ok := upd["$setOnInsert"].(bson.M); ok {
+			insert = prev
+		}
+		insert[t.storageField(t.key)] = (*mongoView)(t).keyValue(key)
+		upd["$setOnInsert"] = insert
+	}
+	generate := false
+	if _, ok := filter[t.storageField(t.key)]; !ok {
+		if t.keyMissing(payload) {
+			generate = true
+		} else if t.keyID && payload[t.key] != nil {
+			setOnInsertKey(payload[t.key])
+		}
+	}
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
-	_, err := t.coll().UpdateOne(ctx, bson.M(filter), upd, options.Update().SetUpsert(true))
-	if err != nil {
+	if generate {
+		// only spend a generated key (e.g. a sequence value) on the insert branch
+		err := t.coll().FindOne(ctx, bson.M(filter), options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			key, err := t.newKey()
+			if err != nil {
+				t.base.setError(err)
+				return nil
+			}
+			setOnInsertKey(key)
+		case err != nil:
+			t.base.setError(err)
+			return nil
+		}
+	}
+	if _, err := t.coll().UpdateOne(ctx, bson.M(filter), upd, options.Update().SetUpsert(true)); err != nil {
 		t.base.setError(err)
 		return nil
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
-	out := t.First(filter)
+	t.base.touchTableCache(t.source)
+	out := t.writeView().First(filter)
 	keys := t.collectKeys([]Map{out})
 	var key Any
 	if len(keys) > 0 {
 		key = keys[0]
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpsert, 1, key, keys, nil, filter)
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpsert, 1, key, keys, nil, filter)
+	})
 	return out
 }
 
@@ -1981,21 +2296,23 @@ func (t *mongoTable) updateEntity(item Map, dataIn Map) Map {
 		return nil
 	}
 	payload := t.withAutoUpdateStamp(dataIn)
-	upd := buildUpdateDocWithFields(t.base, payload, t.fields)
+	upd := t.updateDoc(payload)
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
-	_, err := t.coll().UpdateOne(ctx, bson.M{t.base.storageField(t.key): item[t.key]}, upd)
+	_, err := t.coll().UpdateOne(ctx, t.keyFilter(item[t.key]), upd)
 	if err != nil {
 		t.base.setError(err)
 		return nil
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
+	t.base.touchTableCache(t.source)
 	keys := []Any(nil)
 	if t.base.watcherKeysEnabled() && item[t.key] != nil {
 		keys = []Any{item[t.key]}
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, 1, item[t.key], keys, payload, Map{t.key: item[t.key]})
-	return t.First(Map{t.key: item[t.key]})
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, 1, item[t.key], keys, payload, Map{t.key: item[t.key]})
+	})
+	return t.writeView().First(Map{t.key: item[t.key]})
 }
 
 func (t *mongoTable) Update(sets Map, args ...Any) Map {
@@ -2009,10 +2326,10 @@ func (t *mongoTable) Update(sets Map, args ...Any) Map {
 		t.base.setError(err)
 		return nil
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	(*mongoView)(t).applyTrashScope(&q)
 	q = t.ensureSingleMutationQuery(q)
-	items, err := (*mongoView)(t).queryWithQuery(q)
+	items, err := t.writeView().queryWithQuery(q)
 	if err != nil {
 		t.base.setError(err)
 		return nil
@@ -2042,7 +2359,7 @@ func (t *mongoTable) UpdateMany(sets Map, args ...Any) int64 {
 		t.base.setError(err)
 		return 0
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	(*mongoView)(t).applyTrashScope(&q)
 	keys, keyErr := t.mutationKeysForQuery(q, t.base.watcherKeysEnabled())
 	if keyErr != nil {
@@ -2058,17 +2375,19 @@ func (t *mongoTable) UpdateMany(sets Map, args ...Any) int64 {
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
 	payload := t.withAutoUpdateStamp(sets)
-	res, err := t.coll().UpdateMany(ctx, filter, buildUpdateDocWithFields(t.base, payload, t.fields))
+	res, err := t.coll().UpdateMany(ctx, filter, t.updateDoc(payload))
 	if err != nil {
 		t.base.setError(err)
 		return 0
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
+	t.base.touchTableCache(t.source)
 	var key Any
 	if len(keys) > 0 {
 		key = keys[0]
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, res.ModifiedCount, key, keys, payload, where)
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, res.ModifiedCount, key, keys, payload, where)
+	})
 	t.base.setError(nil)
 	return res.ModifiedCount
 }
@@ -2088,11 +2407,11 @@ func (t *mongoTable) Remove(args ...Any) Map {
 		t.base.setError(err)
 		return nil
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	q.Unscoped = true
 	q.Filter = mergeMongoExpr(q.Filter, data.NullExpr{Field: t.base.storageField(t.base.trashField()), Yes: true})
 	q = t.ensureSingleMutationQuery(q)
-	items, err := (*mongoView)(t).queryWithQuery(q)
+	items, err := t.writeView().queryWithQuery(q)
 	if err != nil {
 		t.base.setError(err)
 		return nil
@@ -2110,7 +2429,7 @@ func (t *mongoTable) Remove(args ...Any) Map {
 	payload := t.withAutoUpdateStamp(Map{t.base.trashField(): t.base.trashValue()})
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
-	_, err = t.coll().UpdateOne(ctx, bson.M{t.base.storageField(t.key): id}, buildUpdateDocWithFields(t.base, payload, t.fields))
+	_, err = t.coll().UpdateOne(ctx, t.keyFilter(id), t.updateDoc(payload))
 	if err != nil {
 		t.base.setError(err)
 		return nil
@@ -2122,12 +2441,14 @@ func (t *mongoTable) Remove(args ...Any) Map {
 		}
 		out[k] = v
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
+	t.base.touchTableCache(t.source)
 	keys := []Any(nil)
 	if t.base.watcherKeysEnabled() && id != nil {
 		keys = []Any{id}
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, 1, id, keys, payload, Map{t.key: id})
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, 1, id, keys, payload, Map{t.key: id})
+	})
 	t.cascadeRemoveKeys([]Any{id})
 	t.base.setError(nil)
 	return out
@@ -2147,7 +2468,7 @@ func (t *mongoTable) RemoveMany(args ...Any) int64 {
 		t.base.setError(err)
 		return 0
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	q.Unscoped = true
 	q.Filter = mergeMongoExpr(q.Filter, data.NullExpr{Field: t.base.storageField(t.base.trashField()), Yes: true})
 	keys, keyErr := t.mutationKeysForQuery(q, true)
@@ -2179,11 +2500,11 @@ func (t *mongoTable) Restore(args ...Any) Map {
 		t.base.setError(err)
 		return nil
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	q.Unscoped = true
 	q.Filter = mergeMongoExpr(q.Filter, data.NullExpr{Field: t.base.storageField(t.base.trashField()), Yes: false})
 	q = t.ensureSingleMutationQuery(q)
-	items, err := (*mongoView)(t).queryWithQuery(q)
+	items, err := t.writeView().queryWithQuery(q)
 	if err != nil {
 		t.base.setError(err)
 		return nil
@@ -2201,19 +2522,21 @@ func (t *mongoTable) Restore(args ...Any) Map {
 	payload := t.withAutoUpdateStamp(Map{t.base.trashField(): nil})
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
-	_, err = t.coll().UpdateOne(ctx, bson.M{t.base.storageField(t.key): id}, buildUpdateDocWithFields(t.base, payload, t.fields))
+	_, err = t.coll().UpdateOne(ctx, t.keyFilter(id), t.updateDoc(payload))
 	if err != nil {
 		t.base.setError(err)
 		return nil
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
+	t.base.touchTableCache(t.source)
 	keys := []Any(nil)
 	if t.base.watcherKeysEnabled() && id != nil {
 		keys = []Any{id}
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, 1, id, keys, payload, Map{t.key: id})
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, 1, id, keys, payload, Map{t.key: id})
+	})
 	t.cascadeRestoreKeys([]Any{id})
-	out := t.First(Map{t.key: id})
+	out := t.writeView().First(Map{t.key: id})
 	if out == nil && t.base.Error() == nil {
 		out = cloneMap(item)
 		delete(out, t.base.trashField())
@@ -2236,7 +2559,7 @@ func (t *mongoTable) RestoreMany(args ...Any) int64 {
 		t.base.setError(err)
 		return 0
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	q.Unscoped = true
 	q.Filter = mergeMongoExpr(q.Filter, data.NullExpr{Field: t.base.storageField(t.base.trashField()), Yes: false})
 	keys, keyErr := t.mutationKeysForQuery(q, true)
@@ -2264,10 +2587,10 @@ func (t *mongoTable) Delete(args ...Any) Map {
 		t.base.setError(err)
 		return nil
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	(*mongoView)(t).applyTrashScope(&q)
 	q = t.ensureSingleMutationQuery(q)
-	items, err := (*mongoView)(t).queryWithQuery(q)
+	items, err := t.writeView().queryWithQuery(q)
 	if err != nil {
 		t.base.setError(err)
 		return nil
@@ -2283,18 +2606,20 @@ func (t *mongoTable) Delete(args ...Any) Map {
 	}
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
-	res, err := t.coll().DeleteOne(ctx, bson.M{t.base.storageField(t.key): id})
+	res, err := t.coll().DeleteOne(ctx, t.keyFilter(id))
 	if err != nil {
 		t.base.setError(err)
 		return nil
 	}
 	if res.DeletedCount > 0 {
-		data.TouchTableCache(t.base.inst.Name, t.source)
+		t.base.touchTableCache(t.source)
 		keys := []Any(nil)
 		if t.base.watcherKeysEnabled() && id != nil {
 			keys = []Any{id}
 		}
-		data.EmitMutation(t.base.inst.Name, t.source, data.MutationDelete, res.DeletedCount, id, keys, nil, Map{t.key: id})
+		t.base.afterCommit(func() {
+			data.EmitMutation(t.base.inst.Name, t.source, data.MutationDelete, res.DeletedCount, id, keys, nil, Map{t.key: id})
+		})
 	}
 	t.base.setError(nil)
 	if res.DeletedCount == 0 {
@@ -2313,7 +2638,7 @@ func (t *mongoTable) DeleteMany(args ...Any) int64 {
 		t.base.setError(err)
 		return 0
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	(*mongoView)(t).applyTrashScope(&q)
 	keys, keyErr := t.mutationKeysForQuery(q, t.base.watcherKeysEnabled())
 	if keyErr != nil {
@@ -2333,12 +2658,14 @@ func (t *mongoTable) DeleteMany(args ...Any) int64 {
 		t.base.setError(err)
 		return 0
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
+	t.base.touchTableCache(t.source)
 	var key Any
 	if len(keys) > 0 {
 		key = keys[0]
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationDelete, res.DeletedCount, key, keys, nil, where)
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationDelete, res.DeletedCount, key, keys, nil, where)
+	})
 	t.base.setError(nil)
 	return res.DeletedCount
 }
@@ -2363,7 +2690,7 @@ func (t *mongoTable) Group(field string, args ...Any) []Map {
 
 func (t *mongoTable) ensureSingleMutationQuery(q data.Query) data.Query {
 	if len(q.Sort) == 0 {
-		key := strings.TrimSpace(t.base.storageField(t.key))
+		key := strings.TrimSpace(t.storageField(t.key))
 		if key != "" {
 			q.Sort = []data.Sort{{Field: key}}
 		}
@@ -2378,7 +2705,7 @@ func (t *mongoTable) mutationKeysForQuery(q data.Query, enabled bool) ([]Any, er
 		return nil, nil
 	}
 	qq := applyAfter(q)
-	key := strings.TrimSpace(t.base.storageField(t.key))
+	key := strings.TrimSpace(t.storageField(t.key))
 	if key == "" {
 		return nil, nil
 	}
@@ -2532,7 +2859,7 @@ func (t *mongoTable) pickPrimaryValue(args ...Any) (Any, bool) {
 	if len(args) == 0 {
 		return nil, false
 	}
-	storageKey := t.base.storageField(t.key)
+	storageKey := t.storageField(t.key)
 	for _, arg := range args {
 		m, ok := arg.(Map)
 		if !ok || len(m) == 0 {
@@ -2591,17 +2918,19 @@ func (t *mongoTable) updateManyWithQuery(sets Map, q data.Query, where Map) int6
 	}
 	ctx, cancel := t.base.opContext(10 * time.Second)
 	defer cancel()
-	res, err := t.coll().UpdateMany(ctx, filter, buildUpdateDocWithFields(t.base, payload, t.fields))
+	res, err := t.coll().UpdateMany(ctx, filter, t.updateDoc(payload))
 	if err != nil {
 		t.base.setError(err)
 		return 0
 	}
-	data.TouchTableCache(t.base.inst.Name, t.source)
+	t.base.touchTableCache(t.source)
 	var key Any
 	if len(keys) > 0 {
 		key = keys[0]
 	}
-	data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, res.ModifiedCount, key, keys, payload, where)
+	t.base.afterCommit(func() {
+		data.EmitMutation(t.base.inst.Name, t.source, data.MutationUpdate, res.ModifiedCount, key, keys, payload, where)
+	})
 	t.base.setError(nil)
 	return res.ModifiedCount
 }
@@ -2641,7 +2970,7 @@ func (t *mongoTable) removeManyCascade(value string, args ...Any) int64 {
 		t.base.setError(err)
 		return 0
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	q.Unscoped = true
 	q.Filter = mergeMongoExpr(q.Filter, data.NullExpr{Field: t.base.storageField(t.base.trashField()), Yes: true})
 	return t.updateManyWithQuery(Map{t.base.trashField(): value}, q, t.queryArgsMap(args...))
@@ -2653,7 +2982,7 @@ func (t *mongoTable) restoreManyCascade(value string, args ...Any) int64 {
 		t.base.setError(err)
 		return 0
 	}
-	q = t.base.mapQueryToStorage(q)
+	q = t.mapQuery(q)
 	q.Unscoped = true
 	q.Filter = mergeMongoExpr(q.Filter, data.CmpExpr{Field: t.base.storageField(t.base.trashField()), Op: OpEq, Value: value})
 	return t.updateManyWithQuery(Map{t.base.trashField(): nil}, q, t.queryArgsMap(args...))
@@ -2728,6 +3057,27 @@ func (t *mongoTable) autoUpdateFieldName() string {
 
 func (v *mongoView) coll() *mongo.Collection { return v.base.conn.db.Collection(v.source) }
 
+func (v *mongoView) readColl() *mongo.Collection {
+	rp := v.readPref()
+	if rp == nil {
+		return v.coll()
+	}
+	return v.base.conn.db.Collection(v.source, options.Collection().SetReadPreference(rp))
+}
+
+func (v *mongoView) readPref() *readpref.ReadPref {
+	if v.primary || v.base.inTx() {
+		return nil
+	}
+	v.base.mutex.RLock()
+	rp := v.base.rp
+	v.base.mutex.RUnlock()
+	if rp == nil {
+		rp = v.rp
+	}
+	return rp
+}
+
 func (v *mongoView) trashScopedField() (string, bool) {
 	if v == nil || v.base == nil || !v.base.trashEnabled() {
 		return "", false
@@ -2763,12 +3113,16 @@ func (v *mongoView) Count(args ...Any) int64 {
 		v.base.setError(err)
 		return 0
 	}
-	q = v.base.mapQueryToStorage(q)
+	q = v.mapQuery(q)
 	v.applyTrashScope(&q)
 	if total, ok := v.loadCountCache(q); ok {
 		v.base.setError(nil)
 		return total
 	}
+	if err := v.base.ensureAvailable(v.name + ".count"); err != nil {
+		v.base.setError(err)
+		return 0
+	}
 	filter, err := exprToFilter(q.Filter)
 	if err != nil {
 		v.base.setError(err)
@@ -2776,7 +3130,7 @@ func (v *mongoView) Count(args ...Any) int64 {
 	}
 	ctx, cancel := v.base.opContext(10 * time.Second)
 	defer cancel()
-	total, err := v.coll().CountDocuments(ctx, filter)
+	total, err := v.readColl().CountDocuments(ctx, filter)
 	if err != nil {
 		v.base.setError(err)
 		return 0
@@ -2793,7 +3147,7 @@ func (v *mongoView) First(args ...Any) Map {
 		return nil
 	}
 	q.Limit = 1
-	q = v.base.mapQueryToStorage(q)
+	q = v.mapQuery(q)
 	v.applyTrashScope(&q)
 	items, err := v.queryWithQuery(q)
 	if err != nil {
@@ -2814,7 +3168,7 @@ func (v *mongoView) Query(args ...Any) []Map {
 		v.base.setError(err)
 		return nil
 	}
-	q = v.base.mapQueryToStorage(q)
+	q = v.mapQuery(q)
 	v.applyTrashScope(&q)
 	items, err := v.queryWithQuery(q)
 	v.base.setError(err)
@@ -2830,7 +3184,7 @@ func (v *mongoView) Aggregate(args ...Any) []Map {
 	if len(q.Aggs) == 0 {
 		q.Aggs = []data.Agg{{Alias: "$count", Op: "count", Field: "*"}}
 	}
-	q = v.base.mapQueryToStorage(q)
+	q = v.mapQuery(q)
 	v.applyTrashScope(&q)
 	items, err := v.aggregateWithQuery(q)
 	v.base.setError(err)
@@ -2850,7 +3204,7 @@ func (v *mongoView) ScanN(limit int64, next data.ScanFunc, args ...Any) Res {
 		v.base.setError(err)
 		return nil
 	}
-	q = v.base.mapQueryToStorage(q)
+	q = v.mapQuery(q)
 	v.applyTrashScope(&q)
 	if limit > 0 {
 		q.Limit = limit
@@ -2914,12 +3268,12 @@ func (v *mongoView) Slice(offset, limit int64, args ...Any) (int64, []Map) {
 		v.base.setError(err)
 		return 0, nil
 	}
-	q = v.base.mapQueryToStorage(q)
+	q = v.mapQuery(q)
 	v.applyTrashScope(&q)
 	q.Offset = offset
 	q.Limit = limit
 	if len(q.Sort) == 0 {
-		key := strings.TrimSpace(v.base.storageField(v.key))
+		key := strings.TrimSpace(v.storageField(v.key))
 		if key != "" {
 			q.Sort = []data.Sort{{Field: key}}
 		}
@@ -2949,7 +3303,7 @@ func (v *mongoView) Group(field string, args ...Any) []Map {
 	if len(q.Aggs) == 0 {
 		q.Aggs = []data.Agg{{Alias: "$count", Op: "count", Field: "*"}}
 	}
-	q = v.base.mapQueryToStorage(q)
+	q = v.mapQuery(q)
 	v.applyTrashScope(&q)
 	items, err := v.aggregateWithQuery(q)
 	v.base.setError(err)
@@ -2976,15 +3330,45 @@ func (v *mongoView) queryWithQuery(q data.Query) ([]Map, error) {
 	if items, ok := v.loadQueryCache(q); ok {
 		return items, nil
 	}
-	filter, err := exprToFilter(q.Filter)
+	if err := v.base.ensureAvailable(v.name + ".query"); err != nil {
+		return nil, err
+	}
+	filter, findOpts, err := v.findSpec(q)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := v.base.opContext(15 * time.Second)
+	defer cancel()
+	cur, err := v.readColl().Find(ctx, filter, findOpts)
 	if err != nil {
 		return nil, err
 	}
+	defer cur.Close(ctx)
+	out := make([]Map, 0)
+	for cur.Next(ctx) {
+		m := bson.M{}
+		if err := cur.Decode(&m); err != nil {
+			return nil, err
+		}
+		out = append(out, v.toAppMap(bsonToMap(m)))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	v.storeQueryCache(q, out)
+	return out, nil
+}
+
+func (v *mongoView) findSpec(q data.Query) (bson.M, *options.FindOptions, error) {
+	filter, err := exprToFilter(q.Filter)
+	if err != nil {
+		return nil, nil, err
+	}
 	findOpts := options.Find()
 	if len(q.Select) > 0 {
-		proj := bson.M{}
+		proj := bson.D{}
 		for _, field := range q.Select {
-			proj[field] = 1
+			proj = append(proj, bson.E{Key: field, Value: 1})
 		}
 		findOpts.SetProjection(proj)
 	}
@@ -3008,30 +3392,11 @@ func (v *mongoView) queryWithQuery(q data.Query) ([]Map, error) {
 	if q.Batch > 0 {
 		findOpts.SetBatchSize(int32(q.Batch))
 	}
-	ctx, cancel := v.base.opContext(15 * time.Second)
-	defer cancel()
-	cur, err := v.coll().Find(ctx, filter, findOpts)
-	if err != nil {
-		return nil, err
-	}
-	defer cur.Close(ctx)
-	out := make([]Map, 0)
-	for cur.Next(ctx) {
-		m := bson.M{}
-		if err := cur.Decode(&m); err != nil {
-			return nil, err
-		}
-		out = append(out, v.base.toAppMap(bsonToMap(m)))
-	}
-	if err := cur.Err(); err != nil {
-		return nil, err
-	}
-	v.storeQueryCache(q, out)
-	return out, nil
+	return filter, findOpts, nil
 }
 
 func (v *mongoView) loadQueryCache(q data.Query) ([]Map, bool) {
-	if v == nil || v.base == nil || !v.base.cacheEnabled() {
+	if v == nil || v.base == nil || !v.base.cacheEnabled() || v.base.inTx() {
 		return nil, false
 	}
 	token := data.CacheToken(v.base.inst.Name, v.cacheTables(q))
@@ -3052,7 +3417,7 @@ func (v *mongoView) loadQueryCache(q data.Query) ([]Map, bool) {
 }
 
 func (v *mongoView) storeQueryCache(q data.Query, items []Map) {
-	if v == nil || v.base == nil || !v.base.cacheEnabled() {
+	if v == nil || v.base == nil || !v.base.cacheEnabled() || v.base.inTx() {
 		return
 	}
 	ttl := v.base.cacheTTL()
@@ -3069,7 +3434,7 @@ func (v *mongoView) storeQueryCache(q data.Query, items []Map) {
 }
 
 func (v *mongoView) loadCountCache(q data.Query) (int64, bool) {
-	if v == nil || v.base == nil || !v.base.cacheEnabled() {
+	if v == nil || v.base == nil || !v.base.cacheEnabled() || v.base.inTx() {
 		return 0, false
 	}
 	token := data.CacheToken(v.base.inst.Name, v.cacheTables(q))
@@ -3090,7 +3455,7 @@ func (v *mongoView) loadCountCache(q data.Query) (int64, bool) {
 }
 
 func (v *mongoView) storeCountCache(q data.Query, total int64) {
-	if v == nil || v.base == nil || !v.base.cacheEnabled() {
+	if v == nil || v.base == nil || !v.base.cacheEnabled() || v.base.inTx() {
 		return
 	}
 	ttl := v.base.cacheTTL()
@@ -3117,12 +3482,51 @@ func (v *mongoView) cacheTables(q data.Query) []string {
 }
 
 func (v *mongoView) aggregateWithQuery(q data.Query) ([]Map, error) {
-	q = applyAfter(q)
-	pipeline := mongo.Pipeline{}
-	filter, err := exprToFilter(q.Filter)
+	if err := v.base.ensureAvailable(v.name + ".aggregate"); err != nil {
+		return nil, err
+	}
+	pipeline, grouped, groupedByID, err := v.pipelineSpec(applyAfter(q))
 	if err != nil {
 		return nil, err
 	}
+
+	ctx, cancel := v.base.opContext(15 * time.Second)
+	defer cancel()
+	cur, err := v.readColl().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := make([]Map, 0)
+	for cur.Next(ctx) {
+		m := bson.M{}
+		if err := cur.Decode(&m); err != nil {
+			return nil, err
+		}
+		flat := bsonToMap(m)
+		if id, ok := m["_id"].(bson.M); ok {
+			for k, v := range id {
+				flat[k] = normalizeBsonValue(v)
+			}
+		}
+		if grouped && !groupedByID {
+			out = append(out, v.base.toAppMap(flat))
+			continue
+		}
+		out = append(out, v.toAppMap(flat))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *mongoView) pipelineSpec(q data.Query) (pipeline mongo.Pipeline, grouped, groupedByID bool, err error) {
+	pipeline = mongo.Pipeline{}
+	filter, err := exprToFilter(q.Filter)
+	if err != nil {
+		return nil, false, false, err
+	}
 	if len(filter) > 0 {
 		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
 	}
@@ -3148,7 +3552,7 @@ func (v *mongoView) aggregateWithQuery(q data.Query) ([]Map, error) {
 			foreignAliases := []string{alias, join.From}
 			expr, err := exprToLookupExpr(join.On, localAliases, foreignAliases, letVars)
 			if err != nil {
-				return nil, err
+				return nil, false, false, err
 			}
 			lk := bson.M{
 				"from":     join.From,
@@ -3161,12 +3565,14 @@ func (v *mongoView) aggregateWithQuery(q data.Query) ([]Map, error) {
 			pipeline = append(pipeline, bson.D{{Key: "$lookup", Value: lk}})
 			continue
 		}
-		return nil, fmt.Errorf("mongodb join requires localField/foreignField or on")
+		return nil, false, false, fmt.Errorf("mongodb join requires localField/foreignField or on")
 	}
-	if len(q.Group) > 0 || len(q.Aggs) > 0 {
+	grouped = len(q.Group) > 0 || len(q.Aggs) > 0
+	if grouped {
 		groupID := bson.M{}
 		for _, g := range q.Group {
 			groupID[g] = "$" + g
+			groupedByID = groupedByID || g == "_id"
 		}
 		if len(groupID) == 0 {
 			groupID = nil
@@ -3194,14 +3600,14 @@ func (v *mongoView) aggregateWithQuery(q data.Query) ([]Map, error) {
 			case "max":
 				groupDoc[agg.Alias] = bson.M{"$max": target}
 			default:
-				return nil, fmt.Errorf("unsupported agg op %s", agg.Op)
+				return nil, false, false, fmt.Errorf("unsupported agg op %s", agg.Op)
 			}
 		}
 		pipeline = append(pipeline, bson.D{{Key: "$group", Value: groupDoc}})
 		if q.Having != nil {
 			having, err := exprToFilter(q.Having)
 			if err != nil {
-				return nil, err
+				return nil, false, false, err
 			}
 			if len(having) > 0 {
 				pipeline = append(pipeline, bson.D{{Key: "$match", Value: having}})
@@ -3225,32 +3631,7 @@ func (v *mongoView) aggregateWithQuery(q data.Query) ([]Map, error) {
 	if q.Limit > 0 {
 		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: q.Limit}})
 	}
-
-	ctx, cancel := v.base.opContext(15 * time.Second)
-	defer cancel()
-	cur, err := v.coll().Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cur.Close(ctx)
-	out := make([]Map, 0)
-	for cur.Next(ctx) {
-		m := bson.M{}
-		if err := cur.Decode(&m); err != nil {
-			return nil, err
-		}
-		flat := bsonToMap(m)
-		if id, ok := m["_id"].(bson.M); ok {
-			for k, v := range id {
-				flat[k] = normalizeBsonValue(v)
-			}
-		}
-		out = append(out, v.base.toAppMap(flat))
-	}
-	if err := cur.Err(); err != nil {
-		return nil, err
-	}
-	return out, nil
+	return pipeline, grouped, groupedByID, nil
 }
 
 func exprToFilter(expr data.Expr) (bson.M, error) {
@@ -3680,42 +4061,6 @@ func firstArg(args []Any) Any {
 	return args[0]
 }
 
-func parsePipelineArg(v Any) (mongo.Pipeline, error) {
-	if v == nil {
-		return mongo.Pipeline{}, nil
-	}
-	switch vv := v.(type) {
-	case []Map:
-		out := make(mongo.Pipeline, 0, len(vv))
-		for _, m := range vv {
-			out = append(out, mapToDoc(m))
-		}
-		return out, nil
-	case []Any:
-		out := make(mongo.Pipeline, 0, len(vv))
-		for _, item := range vv {
-			m, err := toBsonMap(item)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, mapToDoc(Map(m)))
-		}
-		return out, nil
-	case string:
-		var arr []map[string]any
-		if err := json.Unmarshal([]byte(vv), &arr); err != nil {
-			return nil, err
-		}
-		out := make(mongo.Pipeline, 0, len(arr))
-		for _, m := range arr {
-			out = append(out, mapToDoc(Map(m)))
-		}
-		return out, nil
-	default:
-		return nil, fmt.Errorf("invalid pipeline arg %T", v)
-	}
-}
-
 func toBsonMap(v Any) (bson.M, error) {
 	if v == nil {
 		return bson.M{}, nil
@@ -3725,6 +4070,12 @@ func toBsonMap(v Any) (bson.M, error) {
 		return vv, nil
 	case Map:
 		return bson.M(vv), nil
+	case bson.D:
+		out := bson.M{}
+		for _, elem := range vv {
+			out[elem.Key] = elem.Value
+		}
+		return out, nil
 	case string:
 		out := bson.M{}
 		if err := bson.UnmarshalExtJSON([]byte(vv), false, &out); err == nil {
@@ -3758,29 +4109,6 @@ func toMapSlice(v Any) ([]Map, error) {
 	}
 }
 
-func parseCommand(query string, arg Any) (bson.M, error) {
-	cmd := strings.TrimSpace(query)
-	if strings.EqualFold(cmd, "command") || cmd == "" {
-		return toBsonMap(arg)
-	}
-	if strings.HasPrefix(strings.TrimSpace(cmd), "{") {
-		return toBsonMap(cmd)
-	}
-	parts := strings.Fields(cmd)
-	if len(parts) == 0 {
-		return nil, fmt.Errorf("empty command")
-	}
-	return bson.M{parts[0]: 1}, nil
-}
-
-func mapToDoc(m Map) bson.D {
-	out := bson.D{}
-	for k, v := range m {
-		out = append(out, bson.E{Key: k, Value: v})
-	}
-	return out
-}
-
 func parseInt64(v Any) (int64, bool) {
 	switch vv := v.(type) {
 	case int:
@@ -0,0 +1,288 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+type HealthStatus struct {
+	CheckedOut   int64
+	MaxPool      int64
+	Workload     int64
+	Latency      time.Duration
+	Heartbeat    time.Time
+	Topology     string
+	Writable     bool
+	Transactions bool
+	Breaker      string
+	BreakerSince time.Time
+	LastError    error
+}
+
+type CommandEvent struct {
+	Instance   string
+	Database   string
+	Collection string
+	Name       string
+	RequestID  int64
+	Command    bson.Raw
+	Duration   time.Duration
+	Slow       bool
+	Err        error
+}
+
+type CommandHook interface {
+	CommandStarted(context.Context, CommandEvent)
+	CommandFinished(context.Context, CommandEvent)
+}
+
+var mongoCommandHooks struct {
+	sync.RWMutex
+	items []CommandHook
+}
+
+const mongoSlowLogLimit = 2048
+
+type mongoMonitor struct {
+	mutex      sync.RWMutex
+	name       string
+	slow       time.Duration
+	commands   sync.Map
+	checkedOut atomic.Int64
+	pools      map[string]uint64
+	latency    time.Duration
+	heartbeat  time.Time
+	topology   string
+	writable   bool
+}
+
+func newMongoMonitor(name string, slow time.Duration) *mongoMonitor {
+	return &mongoMonitor{name: name, slow: slow, pools: map[string]uint64{}, topology: "unknown"}
+}
+
+func registerCommandHook(hook CommandHook) {
+	if hook == nil {
+		return
+	}
+	mongoCommandHooks.Lock()
+	mongoCommandHooks.items = append(mongoCommandHooks.items, hook)
+	mongoCommandHooks.Unlock()
+}
+
+func commandHooks() []CommandHook {
+	mongoCommandHooks.RLock()
+	defer mongoCommandHooks.RUnlock()
+	return mongoCommandHooks.items
+}
+
+func (m *mongoMonitor) commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: m.commandStarted,
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			m.commandFinished(ctx, evt.CommandFinishedEvent, nil)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			m.commandFinished(ctx, evt.CommandFinishedEvent, errors.New(evt.Failure))
+		},
+	}
+}
+
+func (m *mongoMonitor) commandStarted(ctx context.Context, evt *event.CommandStartedEvent) {
+	if evt == nil {
+		return
+	}
+	hooks := commandHooks()
+	if m.slow <= 0 && len(hooks) == 0 {
+		return
+	}
+	one := CommandEvent{
+		Instance:   m.name,
+		Database:   evt.DatabaseName,
+		Collection: mongoCommandCollection(evt.CommandName, evt.Command),
+		Name:       evt.CommandName,
+		RequestID:  evt.RequestID,
+		Command:    evt.Command,
+	}
+	m.commands.Store(evt.RequestID, one)
+	for _, hook := range hooks {
+		hook.CommandStarted(ctx, one)
+	}
+}
+
+func (m *mongoMonitor) commandFinished(ctx context.Context, evt event.CommandFinishedEvent, err error) {
+	raw, ok := m.commands.LoadAndDelete(evt.RequestID)
+	if !ok {
+		return
+	}
+	one := raw.(CommandEvent)
+	one.Duration = evt.Duration
+	one.Err = err
+	if m.slow > 0 && one.Duration >= m.slow {
+		one.Slow = true
+		m.logSlow(one)
+	}
+	for _, hook := range commandHooks() {
+		hook.CommandFinished(ctx, one)
+	}
+}
+
+func (m *mongoMonitor) logSlow(one CommandEvent) {
+	detail := ""
+	for _, key := range []string{"filter", "pipeline", "query", "updates", "deletes"} {
+		if val, err := one.Command.LookupErr(key); err == nil {
+			detail = key + "=" + val.String()
+			break
+		}
+	}
+	if len(detail) > mongoSlowLogLimit {
+		detail = detail[:mongoSlowLogLimit] + "..."
+	}
+	status := "ok"
+	if one.Err != nil {
+		status = one.Err.Error()
+	}
+	mongoLogf("mongodb slow command %s.%s %s took %s (%s) %s", one.Database, one.Collection, one.Name, one.Duration, status, detail)
+}
+
+func mongoCommandCollection(name string, cmd bson.Raw) string {
+	if len(cmd) == 0 {
+		return ""
+	}
+	if name == "getMore" {
+		if val, err := cmd.LookupErr("collection"); err == nil {
+			s, _ := val.StringValueOK()
+			return s
+		}
+		return ""
+	}
+	elem, err := cmd.IndexErr(0)
+	if err != nil {
+		return ""
+	}
+	s, _ := elem.Value().StringValueOK()
+	return s
+}
+
+func (m *mongoMonitor) poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: m.poolEvent}
+}
+
+func (m *mongoMonitor) serverMonitor() *event.ServerMonitor {
+	return &event.ServerMonitor{
+		ServerHeartbeatSucceeded:   m.heartbeatSucceeded,
+		TopologyDescriptionChanged: m.topologyChanged,
+	}
+}
+
+func (m *mongoMonitor) poolEvent(evt *event.PoolEvent) {
+	if evt == nil {
+		return
+	}
+	switch evt.Type {
+	case event.GetSucceeded:
+		m.checkedOut.Add(1)
+	case event.ConnectionReturned:
+		if m.checkedOut.Add(-1) < 0 {
+			m.checkedOut.Store(0)
+		}
+	case event.PoolCreated:
+		size := uint64(0)
+		if evt.PoolOptions != nil {
+			size = evt.PoolOptions.MaxPoolSize
+		}
+		m.mutex.Lock()
+		m.pools[evt.Address] = size
+		m.mutex.Unlock()
+	case event.PoolClosedEvent:
+		m.mutex.Lock()
+		delete(m.pools, evt.Address)
+		m.mutex.Unlock()
+	}
+}
+
+func (m *mongoMonitor) heartbeatSucceeded(evt *event.ServerHeartbeatSucceededEvent) {
+	if evt == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.latency = evt.Duration
+	m.heartbeat = time.Now()
+	m.mutex.Unlock()
+}
+
+func (m *mongoMonitor) topologyChanged(evt *event.TopologyDescriptionChangedEvent) {
+	if evt == nil {
+		return
+	}
+	topology, writable := mongoTopologyState(evt.NewDescription)
+	m.mutex.Lock()
+	m.topology = topology
+	m.writable = writable
+	m.mutex.Unlock()
+}
+
+func (m *mongoMonitor) status() HealthStatus {
+	if m == nil {
+		return HealthStatus{Topology: "unknown"}
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	out := HealthStatus{
+		CheckedOut: m.checkedOut.Load(),
+		Latency:    m.latency,
+		Heartbeat:  m.heartbeat,
+		Topology:   m.topology,
+		Writable:   m.writable,
+	}
+	for _, size := range m.pools {
+		out.MaxPool += int64(size)
+	}
+	if out.MaxPool > 0 {
+		out.Workload = out.CheckedOut * 100 / out.MaxPool
+		if out.Workload > 100 {
+			out.Workload = 100
+		}
+	}
+	return out
+}
+
+func mongoTopologyState(desc description.Topology) (string, bool) {
+	switch desc.Kind {
+	case description.Single:
+		for _, srv := range desc.Servers {
+			switch srv.Kind {
+			case description.Standalone:
+				return "standalone", true
+			case description.RSPrimary:
+				return "replset", true
+			case description.Mongos:
+				return "sharded", true
+			case description.RSSecondary, description.RSArbiter, description.RSMember, description.RSGhost:
+				return "replset", false
+			}
+		}
+		return "unknown", false
+	case description.ReplicaSetWithPrimary:
+		return "replset", true
+	case description.ReplicaSet, description.ReplicaSetNoPrimary:
+		return "replset", false
+	case description.Sharded:
+		for _, srv := range desc.Servers {
+			if srv.Kind == description.Mongos {
+				return "sharded", true
+			}
+		}
+		return "sharded", false
+	case description.LoadBalanced:
+		return "loadbalanced", true
+	default:
+		return "unknown", false
+	}
+}
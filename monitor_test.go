@@ -0,0 +1,98 @@
+package data_mongodb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+func TestMongoMonitorWorkload(t *testing.T) {
+	m := newMongoMonitor("test", 0)
+	m.poolEvent(&event.PoolEvent{Type: event.PoolCreated, Address: "a:27017", PoolOptions: &event.MonitorPoolOptions{MaxPoolSize: 10}})
+	for i := 0; i < 4; i++ {
+		m.poolEvent(&event.PoolEvent{Type: event.GetSucceeded, Address: "a:27017"})
+	}
+	m.poolEvent(&event.PoolEvent{Type: event.ConnectionReturned, Address: "a:27017"})
+	m.heartbeatSucceeded(&event.ServerHeartbeatSucceededEvent{Duration: 3 * time.Millisecond})
+	m.topologyChanged(&event.TopologyDescriptionChangedEvent{NewDescription: description.Topology{Kind: description.ReplicaSetWithPrimary}})
+
+	st := m.status()
+	if st.CheckedOut != 3 || st.MaxPool != 10 || st.Workload != 30 {
+		t.Fatalf("unexpected pool status %#v", st)
+	}
+	if st.Latency != 3*time.Millisecond || st.Heartbeat.IsZero() {
+		t.Fatalf("unexpected heartbeat status %#v", st)
+	}
+	if st.Topology != "replset" || !st.Writable {
+		t.Fatalf("unexpected topology status %#v", st)
+	}
+}
+
+func TestMongoTopologyState(t *testing.T) {
+	cases := []struct {
+		desc     description.Topology
+		topology string
+		writable bool
+	}{
+		{description.Topology{Kind: description.Single, Servers: []description.Server{{Kind: description.Standalone}}}, "standalone", true},
+		{description.Topology{Kind: description.ReplicaSetNoPrimary}, "replset", false},
+		{description.Topology{Kind: description.Sharded, Servers: []description.Server{{Kind: description.Mongos}}}, "sharded", true},
+		{description.Topology{Kind: description.Sharded}, "sharded", false},
+	}
+	for _, c := range cases {
+		topology, writable := mongoTopologyState(c.desc)
+		if topology != c.topology || writable != c.writable {
+			t.Fatalf("expected %s/%v, got %s/%v", c.topology, c.writable, topology, writable)
+		}
+	}
+}
+
+type recordCommandHook struct {
+	started  []CommandEvent
+	finished []CommandEvent
+}
+
+func (h *recordCommandHook) CommandStarted(_ context.Context, evt CommandEvent) {
+	h.started = append(h.started, evt)
+}
+
+func (h *recordCommandHook) CommandFinished(_ context.Context, evt CommandEvent) {
+	h.finished = append(h.finished, evt)
+}
+
+func TestMongoCommandMonitorHooks(t *testing.T) {
+	logger := &captureLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+	hook := &recordCommandHook{}
+	RegisterCommandHook(hook)
+	defer func() {
+		mongoCommandHooks.Lock()
+		mongoCommandHooks.items = nil
+		mongoCommandHooks.Unlock()
+	}()
+
+	cmd, _ := bson.Marshal(bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 18}}}}}})
+	m := newMongoMonitor("main", time.Millisecond)
+	mon := m.commandMonitor()
+	mon.Started(context.Background(), &event.CommandStartedEvent{Command: cmd, DatabaseName: "app", CommandName: "find", RequestID: 7})
+	mon.Failed(context.Background(), &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 7, Duration: 5 * time.Millisecond},
+		Failure:              "boom",
+	})
+
+	if len(hook.started) != 1 || hook.started[0].Collection != "users" || hook.started[0].Instance != "main" {
+		t.Fatalf("unexpected started events %#v", hook.started)
+	}
+	if len(hook.finished) != 1 || hook.finished[0].Err == nil || hook.finished[0].Duration != 5*time.Millisecond || !hook.finished[0].Slow {
+		t.Fatalf("unexpected finished events %#v", hook.finished)
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "slow command app.users find") {
+		t.Fatalf("expected slow command through the package logger, got %q", logger.lines)
+	}
+}
@@ -0,0 +1,142 @@
+package data_mongodb
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoExecVerbs maps Exec verbs to the server command they issue, so a
+// policy entry for either name covers both.
+var mongoExecVerbs = map[string]string{
+	"createcollection": "create",
+	"dropcollection":   "drop",
+	"deletemany":       "delete",
+	"updatemany":       "update",
+	"insertmany":       "insert",
+	"createindex":      "createIndexes",
+	"dropindex":        "dropIndexes",
+	"renamecollection": "renameCollection",
+	"replaceone":       "update",
+	"updateone":        "update",
+	"deleteone":        "delete",
+	"findoneandupdate": "findAndModify",
+	"findoneanddelete": "findAndModify",
+	"distinct":         "distinct",
+	"countdocuments":   "aggregate",
+	// each bulkWrite operation is checked against its own command
+	"bulkwrite": "",
+}
+
+type mongoCommandPolicy struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+func parseMongoCommandPolicy(setting Map) (*mongoCommandPolicy, error) {
+	policy := &mongoCommandPolicy{}
+	for _, key := range []string{"commandAllow", "commandDeny"} {
+		raw, ok := setting[key]
+		if !ok || raw == nil {
+			continue
+		}
+		items := parseStringList(raw)
+		if len(items) == 0 {
+			if s, ok := raw.(string); !ok || strings.TrimSpace(s) != "" {
+				return nil, mongoSettingError(key, fmt.Errorf("expected a list of command names, got %v", raw))
+			}
+			continue
+		}
+		names := map[string]bool{}
+		for _, one := range items {
+			names[strings.ToLower(strings.TrimSpace(one))] = true
+		}
+		if key == "commandAllow" {
+			policy.allow = names
+		} else {
+			policy.deny = names
+		}
+	}
+	if policy.allow == nil && policy.deny == nil {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+func (p *mongoCommandPolicy) allowed(name string) bool {
+	if p == nil {
+		return true
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if p.deny[name] {
+		return false
+	}
+	return p.allow == nil || p.allow[name]
+}
+
+func (b *mongoBase) commandPolicy() *mongoCommandPolicy {
+	if b == nil || b.conn == nil {
+		return nil
+	}
+	return b.conn.policy
+}
+
+func (b *mongoBase) checkCommand(op string, names ...string) error {
+	policy := b.commandPolicy()
+	for _, name := range names {
+		if !policy.allowed(name) {
+			return data.Error(op, data.ErrPermission, fmt.Errorf("mongodb command %s is not allowed", name))
+		}
+	}
+	return nil
+}
+
+func (b *mongoBase) checkExecVerb(verb string) error {
+	verb = strings.ToLower(verb)
+	cmd, ok := mongoExecVerbs[verb]
+	if !ok {
+		return nil
+	}
+	if cmd == "" {
+		return b.checkCommand("exec", verb)
+	}
+	return b.checkCommand("exec", verb, cmd)
+}
+
+func (b *mongoBase) checkCommandDoc(cmd bson.D) error {
+	if len(cmd) == 0 || b.commandPolicy() == nil {
+		return nil
+	}
+	if err := b.checkCommand("command", cmd[0].Key); err != nil {
+		return err
+	}
+	if !strings.EqualFold(cmd[0].Key, "aggregate") {
+		return nil
+	}
+	for _, elem := range cmd[1:] {
+		if elem.Key == "pipeline" {
+			if pipeline, err := parsePipelineArg(elem.Value); err == nil {
+				return b.checkPipeline("command", pipeline)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *mongoBase) checkPipeline(op string, pipeline mongo.Pipeline) error {
+	if b.commandPolicy() == nil {
+		return nil
+	}
+	for _, stage := range pipeline {
+		for _, elem := range stage {
+			if err := b.checkCommand(op, elem.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package data_mongodb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+)
+
+func TestParseMongoCommandPolicy(t *testing.T) {
+	if policy, err := parseMongoCommandPolicy(Map{}); err != nil || policy != nil {
+		t.Fatalf("expected no policy by default, got %v / %v", policy, err)
+	}
+	policy, err := parseMongoCommandPolicy(Map{"commandAllow": "find, aggregate,$match,DROP", "commandDeny": []string{"drop"}})
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	for name, want := range map[string]bool{"find": true, "Aggregate": true, "$match": true, "drop": false, "ping": false} {
+		if got := policy.allowed(name); got != want {
+			t.Fatalf("%s: expected allowed=%v", name, want)
+		}
+	}
+	if _, err := parseMongoCommandPolicy(Map{"commandDeny": 3}); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestMongoCommandPolicyRejects(t *testing.T) {
+	policy, _ := parseMongoCommandPolicy(Map{"commandDeny": "dropDatabase,drop,deleteMany,$out,eval"})
+	base := &mongoBase{inst: &data.Instance{Name: "svc"}, conn: &mongodbConnection{policy: policy}, mode: "auto-clear"}
+
+	check := func(what string) {
+		t.Helper()
+		err := base.Error()
+		if !errors.Is(err, data.ErrPermission) {
+			t.Fatalf("%s: expected permission error, got %v", what, err)
+		}
+	}
+	base.Command(Map{"dropDatabase": 1})
+	check("command dropDatabase")
+	base.Raw(`{"eval": "db.x.drop()"}`)
+	check("raw eval")
+	base.Exec("dropCollection orders")
+	check("exec dropCollection")
+	base.Exec("deleteMany orders", Map{})
+	check("exec deleteMany")
+	base.AggregateRaw("orders", `[{"$match": {}}, {"$out": "copy"}]`)
+	check("aggregate $out")
+	base.Command(`{"aggregate": "orders", "pipeline": [{"$out": "copy"}], "cursor": {}}`)
+	check("command aggregate $out")
+
+	allow, _ := parseMongoCommandPolicy(Map{"commandAllow": "aggregate,$match"})
+	base.conn.policy = allow
+	base.FindRaw("orders", Map{})
+	err := base.Error()
+	if !errors.Is(err, data.ErrPermission) || !strings.Contains(err.Error(), "find") {
+		t.Fatalf("expected find blocked by allowlist, got %v", err)
+	}
+	base.Raw("find orders", Map{})
+	check("raw find")
+}
@@ -0,0 +1,549 @@
+package data_mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const mongoCursorCloseTimeout = 5 * time.Second
+
+func findOptionError(key string, err error) error {
+	return data.Error("find", data.ErrValidation, fmt.Errorf("invalid find option %s: %w", key, err))
+}
+
+func buildMongoFindOptions(m Map) (*options.FindOptions, error) {
+	out := options.Find()
+	for key, raw := range m {
+		if raw == nil {
+			continue
+		}
+		switch key {
+		case "sort":
+			sd, err := parseMongoSort(raw)
+			if err != nil {
+				return nil, findOptionError(key, err)
+			}
+			if len(sd) > 0 {
+				out.SetSort(sd)
+			}
+		case "projection", "select", "fields":
+			proj, err := parseMongoProjection(raw)
+			if err != nil {
+				return nil, findOptionError(key, err)
+			}
+			if len(proj) > 0 {
+				out.SetProjection(proj)
+			}
+		case "hint":
+			hint, err := parseMongoHint(raw)
+			if err != nil {
+				return nil, findOptionError(key, err)
+			}
+			out.SetHint(hint)
+		case "collation":
+			coll, err := parseMongoCollation(raw)
+			if err != nil {
+				return nil, findOptionError(key, err)
+			}
+			out.SetCollation(coll)
+		case "maxTimeMS", "maxTime":
+			d, err := parseMongoMaxTime(raw)
+			if err != nil {
+				return nil, findOptionError(key, err)
+			}
+			out.SetMaxTime(d)
+		case "batchSize":
+			n, ok := parseInt64(raw)
+			if !ok || n <= 0 || n > 1<<31-1 {
+				return nil, findOptionError(key, fmt.Errorf("expected positive int32, got %v", raw))
+			}
+			out.SetBatchSize(int32(n))
+		case "allowDiskUse":
+			yes, ok := parseBool(raw)
+			if !ok {
+				return nil, findOptionError(key, fmt.Errorf("expected bool, got %v", raw))
+			}
+			out.SetAllowDiskUse(yes)
+		case "comment":
+			s, ok := raw.(string)
+			if !ok {
+				return nil, findOptionError(key, fmt.Errorf("expected string, got %T", raw))
+			}
+			out.SetComment(s)
+		case "limit":
+			n, ok := parseInt64(raw)
+			if !ok || n < 0 {
+				return nil, findOptionError(key, fmt.Errorf("expected non-negative int, got %v", raw))
+			}
+			if n > 0 {
+				out.SetLimit(n)
+			}
+		case "skip", "offset":
+			n, ok := parseInt64(raw)
+			if !ok || n < 0 {
+				return nil, findOptionError(key, fmt.Errorf("expected non-negative int, got %v", raw))
+			}
+			if n > 0 {
+				out.SetSkip(n)
+			}
+		default:
+			return nil, findOptionError(key, fmt.Errorf("unknown option"))
+		}
+	}
+	return out, nil
+}
+
+func parseMongoSort(raw Any) (bson.D, error) {
+	out := bson.D{}
+	switch vv := raw.(type) {
+	case bson.D:
+		for _, elem := range vv {
+			dir, err := parseMongoSortDirection(elem.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", elem.Key, err)
+			}
+			out = append(out, bson.E{Key: elem.Key, Value: dir})
+		}
+	case Map:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("a Map has no key order, use []Map, bson.D or \"a,-b\" for multiple keys")
+		}
+		for _, k := range keys {
+			dir, err := parseMongoSortDirection(vv[k])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out = append(out, bson.E{Key: k, Value: dir})
+		}
+	case []Map:
+		for _, one := range vv {
+			if len(one) != 1 {
+				return nil, fmt.Errorf("each sort item must have exactly one key, got %d", len(one))
+			}
+			part, err := parseMongoSort(one)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, part...)
+		}
+	case []Any:
+		for _, one := range vv {
+			part, err := parseMongoSort(one)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, part...)
+		}
+	case []string:
+		return parseMongoSort(strings.Join(vv, ","))
+	case string:
+		for _, one := range strings.Split(vv, ",") {
+			one = strings.TrimSpace(one)
+			if one == "" {
+				continue
+			}
+			dir := int32(1)
+			if strings.HasPrefix(one, "-") {
+				dir = -1
+			}
+			one = strings.TrimSpace(strings.TrimLeft(one, "+-"))
+			if one == "" {
+				return nil, fmt.Errorf("empty field in %q", vv)
+			}
+			out = append(out, bson.E{Key: one, Value: dir})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %T", raw)
+	}
+	return out, nil
+}
+
+func parseMongoSortDirection(raw Any) (Any, error) {
+	switch vv := raw.(type) {
+	case Map:
+		if _, ok := vv["$meta"]; ok && len(vv) == 1 {
+			return bson.M{"$meta": vv["$meta"]}, nil
+		}
+	case bson.M:
+		if _, ok := vv["$meta"]; ok && len(vv) == 1 {
+			return vv, nil
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(vv)) {
+		case "1", "asc", "ascending":
+			return int32(1), nil
+		case "-1", "desc", "descending":
+			return int32(-1), nil
+		}
+	case bool:
+		if vv {
+			return int32(1), nil
+		}
+		return int32(-1), nil
+	default:
+		if n, ok := parseIntAny(raw); ok && (n == 1 || n == -1) {
+			return int32(n), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid direction %v, expected 1, -1, asc, desc or {$meta}", raw)
+}
+
+func parseMongoProjection(raw Any) (bson.D, error) {
+	out := bson.D{}
+	switch vv := raw.(type) {
+	case bson.D:
+		return vv, nil
+	case Map:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			val := vv[k]
+			if yes, ok := val.(bool); ok {
+				if yes {
+					val = int32(1)
+				} else {
+					val = int32(0)
+				}
+			} else if n, ok := parseIntAny(val); ok {
+				if n != 0 && n != 1 {
+					return nil, fmt.Errorf("%s: expected 0 or 1, got %v", k, val)
+				}
+				val = int32(n)
+			}
+			out = append(out, bson.E{Key: k, Value: val})
+		}
+	case []string:
+		return parseMongoProjection(strings.Join(vv, ","))
+	case string:
+		for _, one := range strings.Split(vv, ",") {
+			one = strings.TrimSpace(one)
+			if one == "" {
+				continue
+			}
+			val := int32(1)
+			if strings.HasPrefix(one, "-") {
+				val = 0
+				one = strings.TrimSpace(one[1:])
+			}
+			if one == "" {
+				return nil, fmt.Errorf("empty field in %q", vv)
+			}
+			out = append(out, bson.E{Key: one, Value: val})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %T", raw)
+	}
+	return out, nil
+}
+
+func parseMongoHint(raw Any) (Any, error) {
+	switch vv := raw.(type) {
+	case string:
+		if strings.TrimSpace(vv) == "" {
+			return nil, fmt.Errorf("empty index name")
+		}
+		return strings.TrimSpace(vv), nil
+	case bson.D:
+		if len(vv) == 0 {
+			return nil, fmt.Errorf("empty index spec")
+		}
+		return vv, nil
+	case Map, []Map, []Any:
+		return parseMongoSort(vv)
+	}
+	return nil, fmt.Errorf("unsupported type %T", raw)
+}
+
+func parseMongoCollation(raw Any) (*options.Collation, error) {
+	switch vv := raw.(type) {
+	case *options.Collation:
+		if vv == nil || vv.Locale == "" {
+			return nil, fmt.Errorf("locale is required")
+		}
+		return vv, nil
+	case string:
+		if strings.TrimSpace(vv) == "" {
+			return nil, fmt.Errorf("locale is required")
+		}
+		return &options.Collation{Locale: strings.TrimSpace(vv)}, nil
+	case Map:
+		out := &options.Collation{}
+		for key, val := range vv {
+			var ok bool
+			switch key {
+			case "locale":
+				out.Locale, ok = val.(string)
+			case "caseFirst":
+				out.CaseFirst, ok = val.(string)
+			case "alternate":
+				out.Alternate, ok = val.(string)
+			case "maxVariable":
+				out.MaxVariable, ok = val.(string)
+			case "strength":
+				out.Strength, ok = parseIntAny(val)
+				ok = ok && out.Strength >= 1 && out.Strength <= 5
+			case "caseLevel":
+				out.CaseLevel, ok = parseBool(val)
+			case "numericOrdering":
+				out.NumericOrdering, ok = parseBool(val)
+			case "normalization":
+				out.Normalization, ok = parseBool(val)
+			case "backwards":
+				out.Backwards, ok = parseBool(val)
+			default:
+				return nil, fmt.Errorf("unknown field %s", key)
+			}
+			if !ok {
+				return nil, fmt.Errorf("invalid %s: %v", key, val)
+			}
+		}
+		if strings.TrimSpace(out.Locale) == "" {
+			return nil, fmt.Errorf("locale is required")
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", raw)
+}
+
+func parseMongoMaxTime(raw Any) (time.Duration, error) {
+	switch vv := raw.(type) {
+	case time.Duration:
+		if vv <= 0 {
+			return 0, fmt.Errorf("expected positive duration, got %s", vv)
+		}
+		return vv, nil
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(vv))
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("expected positive duration, got %q", vv)
+		}
+		return d, nil
+	}
+	n, ok := parseInt64(raw)
+	if !ok || n <= 0 {
+		return 0, fmt.Errorf("expected positive milliseconds, got %v", raw)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
+
+func (b *mongoBase) findRaw(ctx context.Context, collection string, filter Any, opts []Map, next data.ScanFunc) (Res, error) {
+	if err := b.ensureAvailable("find"); err != nil {
+		return nil, err
+	}
+	if err := b.checkCommand("find", "find"); err != nil {
+		return nil, err
+	}
+	f, err := toBsonMap(filter)
+	if err != nil {
+		return nil, err
+	}
+	findOpts := options.Find()
+	if len(opts) > 0 {
+		findOpts, err = buildMongoFindOptions(opts[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	cur, err := b.conn.db.Collection(collection).Find(ctx, f, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	return scanMongoCursor(ctx, cur, next)
+}
+
+func (b *mongoBase) aggregateRaw(ctx context.Context, collection string, pipeline Any, next data.ScanFunc) (Res, error) {
+	if err := b.ensureAvailable("aggregate"); err != nil {
+		return nil, err
+	}
+	pipe, err := parsePipelineArg(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkCommand("aggregate", "aggregate"); err != nil {
+		return nil, err
+	}
+	if err := b.checkPipeline("aggregate", pipe); err != nil {
+		return nil, err
+	}
+	if isWriteMongoPipeline(pipe) {
+		if err := b.ensureWritable("aggregate"); err != nil {
+			return nil, err
+		}
+	}
+	cur, err := b.conn.db.Collection(collection).Aggregate(ctx, pipe)
+	if err != nil {
+		return nil, err
+	}
+	return scanMongoCursor(ctx, cur, next)
+}
+
+func scanMongoCursor(ctx context.Context, cur *mongo.Cursor, next data.ScanFunc) (Res, error) {
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), mongoCursorCloseTimeout)
+		defer cancel()
+		_ = cur.Close(closeCtx)
+	}()
+	for cur.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		row := bson.M{}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		if res := next(bsonToMap(row)); res != nil && res.Fail() {
+			return res, nil
+		}
+	}
+	return nil, cur.Err()
+}
+
+func (b *mongoBase) FindRawScan(collection string, filter Any, next data.ScanFunc, opts ...Map) Res {
+	if next == nil {
+		return nil
+	}
+	ctx, cancel := b.opContext(0)
+	defer cancel()
+	res, err := b.findRaw(ctx, collection, filter, opts, next)
+	b.setError(err)
+	return res
+}
+
+func (b *mongoBase) AggregateRawScan(collection string, pipeline Any, next data.ScanFunc) Res {
+	if next == nil {
+		return nil
+	}
+	ctx, cancel := b.opContext(0)
+	defer cancel()
+	res, err := b.aggregateRaw(ctx, collection, pipeline, next)
+	b.setError(err)
+	return res
+}
+
+func parseCommand(query string, arg Any) (bson.D, error) {
+	cmd := strings.TrimSpace(query)
+	if strings.EqualFold(cmd, "command") || cmd == "" {
+		return toCommandDoc(arg)
+	}
+	if strings.HasPrefix(cmd, "{") {
+		return toCommandDoc(cmd)
+	}
+	parts := strings.Fields(cmd)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return bson.D{{Key: parts[0], Value: 1}}, nil
+}
+
+func toCommandDoc(v Any) (bson.D, error) {
+	doc, err := toBsonDoc(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	switch v.(type) {
+	case Map, bson.M:
+		// the command name must be the first key, which a Map cannot promise
+		if len(doc) > 1 {
+			return nil, data.Error("command", data.ErrValidation, fmt.Errorf("a Map command has no key order, pass bson.D or Extended JSON for multi-key commands"))
+		}
+	}
+	return doc, nil
+}
+
+func toBsonDoc(v Any) (bson.D, error) {
+	switch vv := v.(type) {
+	case nil:
+		return bson.D{}, nil
+	case bson.D:
+		return vv, nil
+	case bson.Raw:
+		out := bson.D{}
+		if err := bson.Unmarshal(vv, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	case Map:
+		return mapToDoc(vv), nil
+	case bson.M:
+		return mapToDoc(Map(vv)), nil
+	case string:
+		out := bson.D{}
+		if err := bson.UnmarshalExtJSON([]byte(vv), false, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	case []byte:
+		return toBsonDoc(string(vv))
+	}
+	return nil, fmt.Errorf("cannot convert %T to bson.D", v)
+}
+
+func mapToDoc(m Map) bson.D {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(bson.D, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, bson.E{Key: k, Value: m[k]})
+	}
+	return out
+}
+
+func parsePipelineArg(v Any) (mongo.Pipeline, error) {
+	switch vv := v.(type) {
+	case nil:
+		return mongo.Pipeline{}, nil
+	case mongo.Pipeline:
+		return vv, nil
+	case []bson.D:
+		return mongo.Pipeline(vv), nil
+	case []Map:
+		out := make(mongo.Pipeline, 0, len(vv))
+		for _, m := range vv {
+			out = append(out, mapToDoc(m))
+		}
+		return out, nil
+	case []Any:
+		out := make(mongo.Pipeline, 0, len(vv))
+		for _, item := range vv {
+			stage, err := toBsonDoc(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, stage)
+		}
+		return out, nil
+	case bson.A:
+		return parsePipelineArg([]Any(vv))
+	case string:
+		var wrap struct {
+			Pipeline []bson.D `bson:"pipeline"`
+		}
+		if err := bson.UnmarshalExtJSON([]byte(`{"pipeline":`+vv+`}`), false, &wrap); err != nil {
+			return nil, fmt.Errorf("invalid pipeline: %w", err)
+		}
+		return mongo.Pipeline(wrap.Pipeline), nil
+	}
+	return nil, fmt.Errorf("invalid pipeline arg %T", v)
+}
@@ -0,0 +1,249 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"github.com/infrago/infra"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestParseMongoSortOrdered(t *testing.T) {
+	want := bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(-1)}}
+	for _, raw := range []Any{
+		"a,-b",
+		[]string{"a", "-b"},
+		[]Map{{"a": 1}, {"b": "desc"}},
+		bson.D{{Key: "a", Value: 1}, {Key: "b", Value: int64(-1)}},
+	} {
+		got, err := parseMongoSort(raw)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("sort %#v: expected %#v, got %#v (%v)", raw, want, got, err)
+		}
+	}
+	if _, err := parseMongoSort(Map{"a": 1, "b": -1}); err == nil {
+		t.Fatalf("expected multi-key Map sort to be rejected")
+	}
+	if _, err := parseMongoSort(Map{"a": 2}); err == nil {
+		t.Fatalf("expected invalid direction to be rejected")
+	}
+}
+
+func TestBuildMongoFindOptions(t *testing.T) {
+	opts, err := buildMongoFindOptions(Map{
+		"sort":         "-createdAt,_id",
+		"projection":   "name,-secret",
+		"hint":         "name_1",
+		"collation":    Map{"locale": "en", "strength": 2},
+		"maxTimeMS":    1500,
+		"batchSize":    100,
+		"allowDiskUse": true,
+		"comment":      "report",
+		"skip":         20,
+		"limit":        10,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *opts.MaxTime != 1500*time.Millisecond || *opts.BatchSize != 100 || !*opts.AllowDiskUse || *opts.Skip != 20 || *opts.Limit != 10 {
+		t.Fatalf("unexpected options %#v", opts)
+	}
+	if opts.Collation.Locale != "en" || opts.Collation.Strength != 2 || opts.Hint != "name_1" || *opts.Comment != "report" {
+		t.Fatalf("unexpected options %#v", opts)
+	}
+	if !reflect.DeepEqual(opts.Projection, bson.D{{Key: "name", Value: int32(1)}, {Key: "secret", Value: int32(0)}}) {
+		t.Fatalf("unexpected projection %#v", opts.Projection)
+	}
+
+	for _, bad := range []Map{
+		{"batchSize": -1},
+		{"collation": Map{"strength": 2}},
+		{"maxTimeMS": "soon"},
+		{"allowDiskUse": "maybe"},
+		{"hint": ""},
+		{"skip": -5},
+		{"limt": 10},
+		{"sort": Map{"b": -1, "a": 1}},
+	} {
+		if _, err := buildMongoFindOptions(bad); !errors.Is(err, data.ErrValidation) {
+			t.Fatalf("expected validation error for %#v, got %v", bad, err)
+		}
+	}
+}
+
+func TestScanMongoCursor(t *testing.T) {
+	docs := []interface{}{bson.M{"n": 1}, bson.M{"n": 2}, bson.M{"n": 3}}
+
+	cur, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		t.Fatalf("cursor: %v", err)
+	}
+	seen := 0
+	res, err := scanMongoCursor(context.Background(), cur, func(row Map) Res {
+		seen++
+		if seen == 2 {
+			return infra.Fail
+		}
+		return nil
+	})
+	if err != nil || res == nil || !res.Fail() || seen != 2 {
+		t.Fatalf("expected early stop after two rows, got %d / %v / %v", seen, res, err)
+	}
+
+	cur, _ = mongo.NewCursorFromDocuments(docs, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	seen = 0
+	_, err = scanMongoCursor(ctx, cur, func(row Map) Res {
+		seen++
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || seen != 0 {
+		t.Fatalf("expected cancelled scan, got %d / %v", seen, err)
+	}
+}
+
+func TestParseCommandOrdered(t *testing.T) {
+	cmd, err := parseCommand("command", `{"find": "orders", "filter": {"b": 1, "a": 2}, "limit": 5}`)
+	if err != nil {
+		t.Fatalf("parse command: %v", err)
+	}
+	if cmd[0].Key != "find" || cmd[1].Key != "filter" || cmd[2].Key != "limit" {
+		t.Fatalf("command order lost: %v", cmd)
+	}
+	if nested, ok := cmd[1].Value.(bson.D); !ok || nested[0].Key != "b" || nested[1].Key != "a" {
+		t.Fatalf("nested order lost: %#v", cmd[1].Value)
+	}
+
+	if _, err = parseCommand("", Map{"limit": 5, "count": "orders", "query": Map{}}); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected multi-key Map command to be rejected, got %v", err)
+	}
+	if cmd, err = parseCommand("", Map{"ping": 1}); err != nil || cmd[0].Key != "ping" {
+		t.Fatalf("expected single-key Map command, got %v / %v", cmd, err)
+	}
+
+	ordered := bson.D{{Key: "collStats", Value: "orders"}, {Key: "scale", Value: 1024}}
+	if cmd, err = parseCommand("command", ordered); err != nil || !reflect.DeepEqual(cmd, ordered) {
+		t.Fatalf("expected bson.D passed through, got %v / %v", cmd, err)
+	}
+	if cmd, err = parseCommand("ping", nil); err != nil || cmd[0].Key != "ping" {
+		t.Fatalf("expected bare command, got %v / %v", cmd, err)
+	}
+}
+
+func TestParsePipelineArgOrdered(t *testing.T) {
+	pipeline, err := parsePipelineArg(`[{"$match": {"status": "paid"}}, {"$sort": {"createdAt": -1, "id": 1}}]`)
+	if err != nil || len(pipeline) != 2 {
+		t.Fatalf("parse pipeline: %v / %v", pipeline, err)
+	}
+	sort, ok := pipeline[1][0].Value.(bson.D)
+	if !ok || sort[0].Key != "createdAt" || sort[1].Key != "id" {
+		t.Fatalf("sort order lost: %#v", pipeline[1][0].Value)
+	}
+
+	stages := []bson.D{{{Key: "$limit", Value: 1}}}
+	for _, raw := range []Any{stages, mongo.Pipeline(stages), []Any{stages[0]}, bson.A{stages[0]}, []Any{`{"$limit": 1}`}} {
+		got, err := parsePipelineArg(raw)
+		if err != nil || len(got) != 1 || got[0][0].Key != "$limit" {
+			t.Fatalf("%T: got %v / %v", raw, got, err)
+		}
+	}
+	if _, err := parsePipelineArg(`{"$limit": 1}`); err == nil {
+		t.Fatalf("expected error for non-array pipeline string")
+	}
+}
+
+func TestIsWriteMongoCommandDoc(t *testing.T) {
+	cases := []struct {
+		cmd  Any
+		want bool
+	}{
+		{`{"drop": "orders"}`, true},
+		{`{"delete": "orders", "deletes": [{"q": {}, "limit": 0}]}`, true},
+		{bson.D{{Key: "createIndexes", Value: "orders"}, {Key: "indexes", Value: bson.A{}}}, true},
+		{`{"renameCollection": "db.a", "to": "db.b"}`, true},
+		{`{"aggregate": "orders", "pipeline": [{"$match": {}}, {"$merge": {"into": "copy"}}], "cursor": {}}`, true},
+		{`{"aggregate": "orders", "pipeline": [{"$match": {}}], "cursor": {}}`, false},
+		{`{"mapReduce": "orders", "out": {"inline": 1}}`, false},
+		{`{"mapReduce": "orders", "out": "totals"}`, true},
+		{`{"find": "orders", "filter": {}}`, false},
+		{"ping", false},
+		{`{"createUser": "eve", "pwd": "x", "roles": []}`, true},
+		{`{"updateUser": "eve", "roles": ["root"]}`, true},
+		{`{"dropUser": "eve"}`, true},
+		{`{"dropAllUsersFromDatabase": 1}`, true},
+		{`{"createRole": "ops", "privileges": [], "roles": []}`, true},
+		{`{"updateRole": "ops", "roles": []}`, true},
+		{`{"dropRole": "ops"}`, true},
+		{`{"dropAllRolesFromDatabase": 1}`, true},
+		{`{"grantRolesToUser": "eve", "roles": ["root"]}`, true},
+		{`{"revokeRolesFromUser": "eve", "roles": ["root"]}`, true},
+		{`{"grantPrivilegesToRole": "ops", "privileges": []}`, true},
+		{`{"revokePrivilegesFromRole": "ops", "privileges": []}`, true},
+		{`{"shutdown": 1}`, true},
+		{`{"fsync": 1, "lock": true}`, true},
+		{`{"reIndex": "orders"}`, true},
+		{`{"bulkWrite": 1, "ops": [], "nsInfo": []}`, true},
+		{`{"setFeatureCompatibilityVersion": "7.0"}`, true},
+		{`{"someFutureCommand": 1}`, true},
+		{`{"usersInfo": 1}`, false},
+		{`{"listIndexes": "orders"}`, false},
+		{`{"count": "orders", "query": {}}`, false},
+		{`{"dbStats": 1}`, false},
+	}
+	for _, c := range cases {
+		query := "command"
+		if s, ok := c.cmd.(string); ok && !strings.HasPrefix(s, "{") {
+			query = s
+		}
+		cmd, err := parseCommand(query, c.cmd)
+		if err != nil {
+			t.Fatalf("%v: %v", c.cmd, err)
+		}
+		if got := isWriteMongoCommandDoc(cmd); got != c.want {
+			t.Fatalf("%v: expected write=%v", c.cmd, c.want)
+		}
+	}
+}
+
+func TestMongoReadOnlyRejectsRawWrites(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "mongo-readonly"}, conn: &mongodbConnection{}, mode: "auto-clear"}
+	res := base.TxReadOnly(func(tx data.DataBase) Res {
+		db := tx.(*mongoBase)
+		if db.Command(Map{"drop": "orders"}); !errors.Is(db.Error(), data.ErrValidation) {
+			return infra.Fail.With("command drop allowed")
+		}
+		if db.Raw(`{"delete": "orders", "deletes": []}`); !errors.Is(db.Error(), data.ErrValidation) {
+			return infra.Fail.With("raw delete allowed")
+		}
+		if db.Exec("collMod orders"); !errors.Is(db.Error(), data.ErrValidation) {
+			return infra.Fail.With("exec collMod allowed")
+		}
+		if db.AggregateRaw("orders", `[{"$match": {}}, {"$out": "copy"}]`); !errors.Is(db.Error(), data.ErrValidation) {
+			return infra.Fail.With("aggregate $out allowed")
+		}
+		db.ClearError()
+		return infra.OK
+	})
+	if res.Fail() {
+		t.Fatalf("readonly raw writes: %s", res.Error())
+	}
+}
+
+func TestMongoRawScannerIsSeparate(t *testing.T) {
+	var _ RawExecutor = (*mongoBase)(nil)
+	var _ RawScanner = (*mongoBase)(nil)
+	if _, ok := AsRawScanner(nil); ok {
+		t.Fatalf("expected nil db not to be a raw scanner")
+	}
+	if res := FindRawScan(nil, "users", Map{}, nil); res != nil {
+		t.Fatalf("expected no result for a non-mongodb db, got %v", res)
+	}
+}
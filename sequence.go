@@ -0,0 +1,305 @@
+package data_mongodb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SequenceInfo struct {
+	Key       string
+	Value     int64
+	UpdatedAt time.Time
+}
+
+type mongoSeqBlock struct {
+	mutex  sync.Mutex
+	offset int64
+	step   int64
+	next   int64
+	left   int64
+}
+
+func (c *mongodbConnection) sequenceBlock(key string) *mongoSeqBlock {
+	c.seqMutex.Lock()
+	defer c.seqMutex.Unlock()
+	if c.seqBlocks == nil {
+		c.seqBlocks = map[string]*mongoSeqBlock{}
+	}
+	blk, ok := c.seqBlocks[key]
+	if !ok {
+		blk = &mongoSeqBlock{}
+		c.seqBlocks[key] = blk
+	}
+	return blk
+}
+
+func (c *mongodbConnection) dropSequenceBlock(key string) {
+	c.seqMutex.Lock()
+	blk := c.seqBlocks[key]
+	delete(c.seqBlocks, key)
+	c.seqMutex.Unlock()
+	if blk != nil {
+		// callers that fetched the block before the delete must not keep using it
+		blk.mutex.Lock()
+		blk.left = 0
+		blk.mutex.Unlock()
+	}
+}
+
+// dropSequenceBlocks discards the in-memory blocks now and again once the
+// surrounding transaction commits, so nothing reserves from the old value.
+func (b *mongoBase) dropSequenceBlocks(keys ...string) {
+	conn := b.conn
+	drop := func() {
+		for _, key := range keys {
+			conn.dropSequenceBlock(key)
+		}
+	}
+	drop()
+	b.afterCommit(drop)
+}
+
+func (c *mongodbConnection) releaseSequenceBlocks() {
+	c.seqMutex.Lock()
+	c.seqBlocks = nil
+	c.seqMutex.Unlock()
+}
+
+func (b *mongoBase) sequenceBlockSize(key string) (int64, error) {
+	if b.inst == nil || b.inst.Config.Setting == nil {
+		return 0, nil
+	}
+	setting := b.inst.Config.Setting
+	if blocks, ok := setting["sequenceBlocks"].(Map); ok {
+		if raw, ok := blocks[key]; ok {
+			size, ok := parseInt64(raw)
+			if !ok || size < 0 {
+				return 0, mongoSettingError("sequenceBlocks."+key, fmt.Errorf("expected non-negative int, got %v", raw))
+			}
+			return size, nil
+		}
+	}
+	raw, ok := setting["sequenceBlock"]
+	if !ok {
+		return 0, nil
+	}
+	size, ok := parseInt64(raw)
+	if !ok || size < 0 {
+		return 0, mongoSettingError("sequenceBlock", fmt.Errorf("expected non-negative int, got %v", raw))
+	}
+	return size, nil
+}
+
+func (b *mongoBase) sequenceFromBlock(key string, size, offset, step int64) (int64, error) {
+	if err := b.ensureWritable("sequence"); err != nil {
+		b.setError(err)
+		return 0, err
+	}
+	if step == 0 {
+		step = 1
+	}
+	blk := b.conn.sequenceBlock(key)
+	blk.mutex.Lock()
+	defer blk.mutex.Unlock()
+	if blk.left <= 0 || blk.offset != offset || blk.step != step {
+		// reserve outside of any session so an aborted transaction cannot hand the same block out twice
+		reserve := b.derive()
+		reserve.tx = nil
+		reserve.sess = nil
+		items, err := reserve.SequenceMany(key, size, offset, step)
+		if err != nil {
+			b.setError(err)
+			return 0, err
+		}
+		blk.offset, blk.step = offset, step
+		blk.next, blk.left = items[0], int64(len(items))
+	}
+	val := blk.next
+	blk.next += step
+	blk.left--
+	b.setError(nil)
+	return val, nil
+}
+
+func (b *mongoBase) sequenceAdmin(op, key string, write bool) (string, error) {
+	var err error
+	if write {
+		err = b.ensureWritable(op)
+	} else {
+		err = b.ensureAvailable(op)
+	}
+	if err != nil {
+		return "", err
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", data.Error(op, data.ErrInvalidSequence, fmt.Errorf("sequence key is empty"))
+	}
+	if err := b.ensureSequenceCollection(); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (b *mongoBase) SequenceCurrent(key string) (int64, bool, error) {
+	key, err := b.sequenceAdmin("sequence.current", key, false)
+	if err != nil {
+		b.setError(err)
+		return 0, false, err
+	}
+	ctx, cancel := b.opContext(10 * time.Second)
+	defer cancel()
+	result := bson.M{}
+	err = b.conn.db.Collection(mongoSequenceCollection).FindOne(ctx, bson.M{"_id": key}).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		b.setError(nil)
+		return 0, false, nil
+	}
+	if err != nil {
+		err = data.Error("sequence.current", data.ErrDriver, err)
+		b.setError(err)
+		return 0, false, err
+	}
+	val, convErr := mongoSequenceInt64(result["value"])
+	if convErr != nil {
+		err = data.Error("sequence.decode", data.ErrDriver, convErr)
+		b.setError(err)
+		return 0, false, err
+	}
+	b.setError(nil)
+	return val, true, nil
+}
+
+func (b *mongoBase) SequenceSet(key string, value int64) error {
+	key, err := b.sequenceAdmin("sequence.set", key, true)
+	if err != nil {
+		b.setError(err)
+		return err
+	}
+	ctx, cancel := b.opContext(10 * time.Second)
+	defer cancel()
+	_, err = b.conn.db.Collection(mongoSequenceCollection).UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"value": value, "updated_at": time.Now().Unix()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		err = data.Error("sequence.set", data.ErrDriver, err)
+		b.setError(err)
+		return err
+	}
+	b.dropSequenceBlocks(key)
+	b.setError(nil)
+	return nil
+}
+
+func (b *mongoBase) SequenceReset(key string) error {
+	key, err := b.sequenceAdmin("sequence.reset", key, true)
+	if err != nil {
+		b.setError(err)
+		return err
+	}
+	ctx, cancel := b.opContext(10 * time.Second)
+	defer cancel()
+	if _, err := b.conn.db.Collection(mongoSequenceCollection).DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		err = data.Error("sequence.reset", data.ErrDriver, err)
+		b.setError(err)
+		return err
+	}
+	b.dropSequenceBlocks(key)
+	b.setError(nil)
+	return nil
+}
+
+func (b *mongoBase) SequenceList(prefix string) ([]SequenceInfo, error) {
+	if err := b.ensureAvailable("sequence.list"); err != nil {
+		b.setError(err)
+		return nil, err
+	}
+	if err := b.ensureSequenceCollection(); err != nil {
+		b.setError(err)
+		return nil, err
+	}
+	ctx, cancel := b.opContext(10 * time.Second)
+	defer cancel()
+	filter := bson.M{}
+	if prefix = strings.TrimSpace(prefix); prefix != "" {
+		filter["_id"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+	cur, err := b.conn.db.Collection(mongoSequenceCollection).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		err = data.Error("sequence.list", data.ErrDriver, err)
+		b.setError(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []SequenceInfo{}
+	for cur.Next(ctx) {
+		row := bson.M{}
+		if err := cur.Decode(&row); err != nil {
+			err = data.Error("sequence.decode", data.ErrDriver, err)
+			b.setError(err)
+			return nil, err
+		}
+		out = append(out, mongoSequenceInfo(row))
+	}
+	if err := cur.Err(); err != nil {
+		err = data.Error("sequence.list", data.ErrDriver, err)
+		b.setError(err)
+		return nil, err
+	}
+	b.setError(nil)
+	return out, nil
+}
+
+func (b *mongoBase) SequenceDrop(keys ...string) (int64, error) {
+	if err := b.ensureWritable("sequence.drop"); err != nil {
+		b.setError(err)
+		return 0, err
+	}
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			ids = append(ids, key)
+		}
+	}
+	if len(ids) == 0 {
+		b.setError(nil)
+		return 0, nil
+	}
+	if err := b.ensureSequenceCollection(); err != nil {
+		b.setError(err)
+		return 0, err
+	}
+	ctx, cancel := b.opContext(10 * time.Second)
+	defer cancel()
+	res, err := b.conn.db.Collection(mongoSequenceCollection).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		err = data.Error("sequence.drop", data.ErrDriver, err)
+		b.setError(err)
+		return 0, err
+	}
+	b.dropSequenceBlocks(ids...)
+	b.setError(nil)
+	return res.DeletedCount, nil
+}
+
+func mongoSequenceInfo(row bson.M) SequenceInfo {
+	info := SequenceInfo{}
+	info.Key, _ = row["_id"].(string)
+	info.Value, _ = mongoSequenceInt64(row["value"])
+	if ts, err := mongoSequenceInt64(row["updated_at"]); err == nil && ts > 0 {
+		info.UpdatedAt = time.Unix(ts, 0)
+	}
+	return info
+}
@@ -0,0 +1,195 @@
+package data_mongodb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+)
+
+type SequenceTemplate struct {
+	Prefix    string
+	Separator string
+	Period    string
+	Padding   int
+	Min       *int64 // nil starts each period at 1
+	Max       int64
+	Step      int64
+	Cycle     bool
+	Location  *time.Location
+}
+
+func (b *mongoBase) SequenceBounded(key string, min, max, step int64, cycle bool) (int64, error) {
+	if step == 0 {
+		step = 1
+	}
+	if min < 0 || step < 0 || (max > 0 && max < min) {
+		err := data.Error("sequence", data.ErrInvalidSequence, fmt.Errorf("invalid sequence bounds: min=%d max=%d step=%d", min, max, step))
+		b.setError(err)
+		return 0, err
+	}
+	items, err := b.SequenceMany(key, 1, min, step)
+	if err != nil {
+		return 0, err
+	}
+	val, err := boundSequenceValue(items[0], min, max, step, cycle)
+	if err != nil {
+		err = data.Error("sequence", data.ErrInvalidSequence, fmt.Errorf("%s: %w", key, err))
+		b.setError(err)
+		return 0, err
+	}
+	return val, nil
+}
+
+func (b *mongoBase) SequenceFormat(key string, tpls ...SequenceTemplate) (string, error) {
+	key = strings.TrimSpace(key)
+	var tpl SequenceTemplate
+	if len(tpls) > 0 {
+		tpl = tpls[0]
+	} else {
+		found, err := b.sequenceTemplate(key)
+		if err != nil {
+			b.setError(err)
+			return "", err
+		}
+		tpl = found
+	}
+	now := time.Now()
+	if tpl.Location != nil {
+		now = now.In(tpl.Location)
+	}
+	stamp, err := sequencePeriodStamp(tpl.Period, now)
+	if err != nil {
+		err = data.Error("sequence", data.ErrInvalidSequence, err)
+		b.setError(err)
+		return "", err
+	}
+	counter := key
+	if stamp != "" {
+		counter = key + ":" + stamp
+	}
+	min := int64(1)
+	if tpl.Min != nil {
+		min = *tpl.Min
+	}
+	val, err := b.SequenceBounded(counter, min, tpl.Max, tpl.Step, tpl.Cycle)
+	if err != nil {
+		return "", err
+	}
+	return formatSequenceValue(tpl, stamp, val), nil
+}
+
+func (b *mongoBase) sequenceTemplate(key string) (SequenceTemplate, error) {
+	tpl := SequenceTemplate{}
+	if b.inst == nil || b.inst.Config.Setting == nil {
+		return tpl, nil
+	}
+	all, ok := b.inst.Config.Setting["sequenceTemplates"].(Map)
+	if !ok {
+		return tpl, nil
+	}
+	cfg, ok := all[key].(Map)
+	if !ok {
+		return tpl, nil
+	}
+	name := "sequenceTemplates." + key
+	for field, dst := range map[string]*string{"prefix": &tpl.Prefix, "separator": &tpl.Separator, "period": &tpl.Period} {
+		v, _, err := mongoSettingString(cfg, field)
+		if err != nil {
+			return tpl, err
+		}
+		*dst = v
+	}
+	for field, dst := range map[string]*int64{"max": &tpl.Max, "step": &tpl.Step} {
+		if raw, ok := cfg[field]; ok {
+			v, ok := parseInt64(raw)
+			if !ok {
+				return tpl, mongoSettingError(name+"."+field, fmt.Errorf("expected int, got %v", raw))
+			}
+			*dst = v
+		}
+	}
+	if raw, ok := cfg["min"]; ok {
+		v, ok := parseInt64(raw)
+		if !ok || v < 0 {
+			return tpl, mongoSettingError(name+".min", fmt.Errorf("expected non-negative int, got %v", raw))
+		}
+		tpl.Min = &v
+	}
+	if raw, ok := cfg["padding"]; ok {
+		v, ok := parseIntAny(raw)
+		if !ok || v < 0 {
+			return tpl, mongoSettingError(name+".padding", fmt.Errorf("expected non-negative int, got %v", raw))
+		}
+		tpl.Padding = v
+	}
+	if raw, ok := cfg["cycle"]; ok {
+		v, ok := parseBool(raw)
+		if !ok {
+			return tpl, mongoSettingError(name+".cycle", fmt.Errorf("expected bool, got %v", raw))
+		}
+		tpl.Cycle = v
+	}
+	zone, _, err := mongoSettingString(cfg, "timezone")
+	if err != nil {
+		return tpl, err
+	}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return tpl, mongoSettingError(name+".timezone", err)
+		}
+		tpl.Location = loc
+	}
+	return tpl, nil
+}
+
+func sequencePeriodStamp(period string, now time.Time) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(period)) {
+	case "", "none":
+		return "", nil
+	case "daily", "day":
+		return now.Format("20060102"), nil
+	case "monthly", "month":
+		return now.Format("200601"), nil
+	case "yearly", "year":
+		return now.Format("2006"), nil
+	}
+	return "", fmt.Errorf("unknown sequence period %q", period)
+}
+
+func boundSequenceValue(val, min, max, step int64, cycle bool) (int64, error) {
+	if max <= 0 || val <= max {
+		return val, nil
+	}
+	if !cycle {
+		return 0, fmt.Errorf("sequence exhausted at %d (max %d)", val, max)
+	}
+	if step <= 0 {
+		step = 1
+	}
+	span := (max-min)/step + 1
+	pos := (val - min) / step
+	return min + (pos%span)*step, nil
+}
+
+func formatSequenceValue(tpl SequenceTemplate, stamp string, val int64) string {
+	num := strconv.FormatInt(val, 10)
+	if tpl.Padding > 0 && len(num) < tpl.Padding {
+		num = strings.Repeat("0", tpl.Padding-len(num)) + num
+	}
+	sep := tpl.Separator
+	if sep == "" {
+		sep = "-"
+	}
+	parts := make([]string, 0, 3)
+	for _, part := range []string{tpl.Prefix, stamp, num} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,188 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMongoSequenceBlockSize(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Config: data.Config{Setting: Map{
+		"sequenceBlock":  100,
+		"sequenceBlocks": Map{"order": 1000, "audit": 0},
+	}}}}
+	for key, want := range map[string]int64{"order": 1000, "audit": 0, "user": 100} {
+		if got, err := base.sequenceBlockSize(key); err != nil || got != want {
+			t.Fatalf("%s: expected %d, got %d (%v)", key, want, got, err)
+		}
+	}
+	base.inst.Config.Setting["sequenceBlock"] = "many"
+	if _, err := base.sequenceBlockSize("user"); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestMongoSequenceServedFromBlock(t *testing.T) {
+	conn := &mongodbConnection{}
+	base := &mongoBase{inst: &data.Instance{Name: "ids", Config: data.Config{Setting: Map{"sequenceBlock": 10}}}, conn: conn, mode: "auto-clear"}
+	blk := conn.sequenceBlock("order")
+	blk.offset, blk.step, blk.next, blk.left = 1, 2, 41, 3
+
+	for _, want := range []int64{41, 43, 45} {
+		got, err := base.Sequence(" order ", 1, 2)
+		if err != nil || got != want {
+			t.Fatalf("expected %d from local block, got %d (%v)", want, got, err)
+		}
+	}
+	if blk.left != 0 {
+		t.Fatalf("expected block exhausted, left %d", blk.left)
+	}
+
+	conn.releaseSequenceBlocks()
+	if conn.sequenceBlock("order") == blk {
+		t.Fatalf("expected blocks released")
+	}
+}
+
+func TestMongoSequenceAdminGuards(t *testing.T) {
+	readonly := &mongoBase{inst: &data.Instance{Name: "ids", Config: data.Config{ReadOnly: true}}, conn: &mongodbConnection{}, mode: "auto-clear"}
+	if err := readonly.SequenceSet("order", 10); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected readonly rejection for set, got %v", err)
+	}
+	if err := readonly.SequenceReset("order"); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected readonly rejection for reset, got %v", err)
+	}
+	if _, err := readonly.SequenceDrop("order"); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected readonly rejection for drop, got %v", err)
+	}
+
+	base := &mongoBase{inst: &data.Instance{Name: "ids"}, conn: &mongodbConnection{}, mode: "auto-clear"}
+	if _, _, err := base.SequenceCurrent("  "); !errors.Is(err, data.ErrInvalidSequence) {
+		t.Fatalf("expected invalid sequence for empty key, got %v", err)
+	}
+	if n, err := base.SequenceDrop(" ", ""); err != nil || n != 0 {
+		t.Fatalf("expected empty drop to be a no-op, got %d (%v)", n, err)
+	}
+}
+
+func TestMongoSequenceFormatting(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	for period, want := range map[string]string{"": "", "daily": "20261018", "monthly": "202610", "yearly": "2026"} {
+		got, err := sequencePeriodStamp(period, now)
+		if err != nil || got != want {
+			t.Fatalf("period %q: expected %q, got %q (%v)", period, want, got, err)
+		}
+	}
+	if _, err := sequencePeriodStamp("hourly", now); err == nil {
+		t.Fatalf("expected unknown period to fail")
+	}
+
+	tpl := SequenceTemplate{Prefix: "ORD", Padding: 6}
+	if got := formatSequenceValue(tpl, "20261018", 123); got != "ORD-20261018-000123" {
+		t.Fatalf("unexpected formatted value %q", got)
+	}
+	if got := formatSequenceValue(SequenceTemplate{Separator: "/"}, "", 7); got != "7" {
+		t.Fatalf("unexpected bare value %q", got)
+	}
+
+	cases := []struct {
+		val, min, max, step int64
+		cycle               bool
+		want                int64
+	}{
+		{5, 1, 9, 1, false, 5},
+		{10, 1, 9, 1, true, 1},
+		{12, 1, 9, 1, true, 3},
+		{11, 1, 9, 2, true, 1},
+		{42, 1, 0, 1, false, 42},
+		{0, 0, 9, 1, true, 0},
+		{10, 0, 9, 1, true, 0},
+		{13, 0, 9, 1, true, 3},
+	}
+	for _, c := range cases {
+		got, err := boundSequenceValue(c.val, c.min, c.max, c.step, c.cycle)
+		if err != nil || got != c.want {
+			t.Fatalf("bound %d in [%d,%d] step %d: expected %d, got %d (%v)", c.val, c.min, c.max, c.step, c.want, got, err)
+		}
+	}
+	if _, err := boundSequenceValue(10, 1, 9, 1, false); err == nil {
+		t.Fatalf("expected exhausted sequence without cycling")
+	}
+}
+
+func TestMongoSequenceTemplateSetting(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Config: data.Config{Setting: Map{
+		"sequenceTemplates": Map{"order": Map{"prefix": "ORD", "period": "daily", "padding": 6, "min": 0, "max": 999999, "cycle": true, "timezone": "UTC"}},
+	}}}}
+	tpl, err := base.sequenceTemplate("order")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tpl.Prefix != "ORD" || tpl.Period != "daily" || tpl.Padding != 6 || tpl.Min == nil || *tpl.Min != 0 || tpl.Max != 999999 || !tpl.Cycle || tpl.Location == nil {
+		t.Fatalf("unexpected template %#v", tpl)
+	}
+	base.inst.Config.Setting["sequenceTemplates"] = Map{"order": Map{"prefix": "ORD"}}
+	if tpl, err := base.sequenceTemplate("order"); err != nil || tpl.Min != nil {
+		t.Fatalf("expected an unset min, got %#v (%v)", tpl, err)
+	}
+	for _, cfg := range []Map{{"padding": "wide"}, {"min": -1}} {
+		base.inst.Config.Setting["sequenceTemplates"] = Map{"order": cfg}
+		if _, err := base.sequenceTemplate("order"); !errors.Is(err, data.ErrValidation) {
+			t.Fatalf("expected validation error for %v, got %v", cfg, err)
+		}
+	}
+}
+
+func TestMongoSequenceFormatterHelpers(t *testing.T) {
+	var _ SequenceFormatter = (*mongoBase)(nil)
+	if _, ok := AsSequenceFormatter(nil); ok {
+		t.Fatalf("expected nil db not to be a sequence formatter")
+	}
+	if _, err := SequenceFormat(nil, "order"); err == nil {
+		t.Fatalf("expected helper to fail for a non-mongodb db")
+	}
+
+	base := &mongoBase{inst: &data.Instance{Name: "ids"}, conn: &mongodbConnection{}, mode: "auto-clear"}
+	_, err := base.SequenceBounded("order", 0, 0, -1, false)
+	if !errors.Is(err, data.ErrInvalidSequence) || !strings.Contains(err.Error(), "min=0") {
+		t.Fatalf("expected zero min to be kept as-is, got %v", err)
+	}
+	if _, err := base.SequenceBounded("order", -1, 9, 1, false); !errors.Is(err, data.ErrInvalidSequence) {
+		t.Fatalf("expected negative min to be rejected, got %v", err)
+	}
+}
+
+func TestMongoSequenceDropInvalidatesBlocks(t *testing.T) {
+	conn := &mongodbConnection{}
+	base := &mongoBase{inst: &data.Instance{Name: "ids"}, conn: conn, mode: "auto-clear"}
+	stale := conn.sequenceBlock("order")
+	stale.offset, stale.step, stale.next, stale.left = 1, 1, 41, 5
+
+	base.dropSequenceBlocks("order")
+	if stale.left != 0 {
+		t.Fatalf("expected a block held by another caller to be emptied, left %d", stale.left)
+	}
+	if conn.sequenceBlock("order") == stale {
+		t.Fatalf("expected the block to be removed")
+	}
+
+	tx := &mongoTx{ctx: mongo.NewSessionContext(context.Background(), nil)}
+	inTx := base.derive()
+	inTx.tx = tx
+	inTx.dropSequenceBlocks("order")
+	refilled := conn.sequenceBlock("order")
+	refilled.left = 5
+	if len(tx.pend) != 1 {
+		t.Fatalf("expected a post-commit drop to be queued, got %d", len(tx.pend))
+	}
+	tx.pend[0]()
+	if refilled.left != 0 || conn.sequenceBlock("order") == refilled {
+		t.Fatalf("expected blocks reserved during the transaction to be dropped on commit")
+	}
+}
@@ -0,0 +1,65 @@
+package data_mongodb
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"github.com/infrago/infra"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (b *mongoBase) session() (mongo.Session, bool, error) {
+	b.mutex.RLock()
+	ses := b.sess
+	b.mutex.RUnlock()
+	if ses != nil {
+		return ses, false, nil
+	}
+	ses, err := b.conn.client.StartSession()
+	return ses, true, err
+}
+
+func (b *mongoBase) Session(fn data.TxFunc) Res {
+	if fn == nil {
+		return infra.OK
+	}
+	b.mutex.RLock()
+	nested := b.sess != nil
+	b.mutex.RUnlock()
+	if nested || b.inTx() {
+		res := txNormalize(fn(b))
+		if res.Fail() {
+			return res
+		}
+		if err := b.Error(); err != nil {
+			return txErrRes(err)
+		}
+		return infra.OK
+	}
+	if b.conn == nil || b.conn.client == nil {
+		err := data.Error("session", data.ErrDriver, fmt.Errorf("invalid mongodb connection"))
+		return txErrRes(err)
+	}
+	if err := b.ensureAvailable("session"); err != nil {
+		return txErrRes(err)
+	}
+	ses, err := b.conn.client.StartSession(options.Session().SetCausalConsistency(true))
+	if err != nil {
+		err = data.Error("session", data.ErrDriver, err)
+		return txErrRes(err)
+	}
+	defer ses.EndSession(context.Background())
+
+	handle := b.derive()
+	handle.sess = ses
+	res := txNormalize(fn(handle))
+	if res.Fail() {
+		return res
+	}
+	// like Tx, errors reach the caller only through the result so concurrent
+	// sessions on the same receiver never see each other's Error()
+	return txErrRes(handle.Error())
+}
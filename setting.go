@@ -0,0 +1,475 @@
+package data_mongodb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+const (
+	mongoDefaultConnectTimeout    = 10 * time.Second
+	mongoDefaultDisconnectTimeout = 5 * time.Second
+)
+
+func mongoSettingError(key string, err error) error {
+	return data.Error("setting", data.ErrValidation, fmt.Errorf("invalid mongodb setting %s: %w", key, err))
+}
+
+func buildMongoClientOptions(dsn string, cfg data.Config, setting Map) (*options.ClientOptions, error) {
+	clientOpt := options.Client().ApplyURI(dsn)
+	if cfg.MaxOpen > 0 {
+		clientOpt.SetMaxPoolSize(uint64(cfg.MaxOpen))
+	}
+	if cfg.MaxIdleTime > 0 {
+		clientOpt.SetMaxConnIdleTime(cfg.MaxIdleTime)
+	}
+	if setting == nil {
+		return clientOpt, nil
+	}
+
+	if raw, ok := setting["tls"]; ok {
+		tlsCfg, err := parseMongoTLS(raw)
+		if err != nil {
+			return nil, mongoSettingError("tls", err)
+		}
+		if tlsCfg != nil {
+			clientOpt.SetTLSConfig(tlsCfg)
+		}
+	}
+
+	mechanism, hasMechanism, err := mongoSettingString(setting, "authMechanism")
+	if err != nil {
+		return nil, err
+	}
+	source, hasSource, err := mongoSettingString(setting, "authSource")
+	if err != nil {
+		return nil, err
+	}
+	if hasMechanism || hasSource {
+		cred := options.Credential{}
+		if clientOpt.Auth != nil {
+			cred = *clientOpt.Auth
+		}
+		if hasMechanism {
+			switch strings.ToUpper(mechanism) {
+			case "SCRAM-SHA-1", "SCRAM-SHA-256", "MONGODB-X509", "MONGODB-AWS", "GSSAPI", "PLAIN", "MONGODB-OIDC":
+				cred.AuthMechanism = strings.ToUpper(mechanism)
+			default:
+				return nil, mongoSettingError("authMechanism", fmt.Errorf("unsupported mechanism %q", mechanism))
+			}
+		}
+		if hasSource {
+			cred.AuthSource = source
+		}
+		clientOpt.SetAuth(cred)
+	}
+
+	if v, ok, err := mongoSettingString(setting, "replicaSet"); err != nil {
+		return nil, err
+	} else if ok {
+		clientOpt.SetReplicaSet(v)
+	}
+	if v, ok, err := mongoSettingString(setting, "appName"); err != nil {
+		return nil, err
+	} else if ok {
+		clientOpt.SetAppName(v)
+	}
+
+	if raw, ok := setting["compressors"]; ok {
+		items := parseStringList(raw)
+		if len(items) == 0 {
+			return nil, mongoSettingError("compressors", fmt.Errorf("expected a list of snappy, zlib or zstd"))
+		}
+		for i, one := range items {
+			one = strings.ToLower(one)
+			switch one {
+			case "snappy", "zlib", "zstd":
+				items[i] = one
+			default:
+				return nil, mongoSettingError("compressors", fmt.Errorf("unsupported compressor %q", one))
+			}
+		}
+		clientOpt.SetCompressors(items)
+	}
+
+	if raw, ok := setting["readPreference"]; ok {
+		rp, err := parseMongoReadPref(raw)
+		if err != nil {
+			return nil, mongoSettingError("readPreference", err)
+		}
+		clientOpt.SetReadPreference(rp)
+	}
+	if raw, ok := setting["readConcern"]; ok {
+		rc, err := parseMongoReadConcern(raw)
+		if err != nil {
+			return nil, mongoSettingError("readConcern", err)
+		}
+		clientOpt.SetReadConcern(rc)
+	}
+	if raw, ok := setting["writeConcern"]; ok {
+		wc, err := parseMongoWriteConcern(raw)
+		if err != nil {
+			return nil, mongoSettingError("writeConcern", err)
+		}
+		clientOpt.SetWriteConcern(wc)
+	}
+
+	if d, ok, err := mongoSettingDuration(setting, "connectTimeout"); err != nil {
+		return nil, err
+	} else if ok {
+		clientOpt.SetConnectTimeout(d)
+	}
+	if d, ok, err := mongoSettingDuration(setting, "serverSelectionTimeout"); err != nil {
+		return nil, err
+	} else if ok {
+		clientOpt.SetServerSelectionTimeout(d)
+	}
+	if d, ok, err := mongoSettingDuration(setting, "socketTimeout"); err != nil {
+		return nil, err
+	} else if ok {
+		clientOpt.SetSocketTimeout(d)
+	}
+
+	for _, key := range []string{"retryReads", "retryWrites"} {
+		raw, ok := setting[key]
+		if !ok {
+			continue
+		}
+		v, yes := parseBool(raw)
+		if !yes {
+			return nil, mongoSettingError(key, fmt.Errorf("expected bool, got %v", raw))
+		}
+		if key == "retryReads" {
+			clientOpt.SetRetryReads(v)
+		} else {
+			clientOpt.SetRetryWrites(v)
+		}
+	}
+
+	if err := clientOpt.Validate(); err != nil {
+		return nil, data.Error("setting", data.ErrValidation, err)
+	}
+	return clientOpt, nil
+}
+
+func mongoSettingString(setting Map, key string) (string, bool, error) {
+	raw, ok := setting[key]
+	if !ok || raw == nil {
+		return "", false, nil
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return "", false, mongoSettingError(key, fmt.Errorf("expected string, got %T", raw))
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", false, nil
+	}
+	return s, true, nil
+}
+
+func mongoSettingDuration(setting Map, key string) (time.Duration, bool, error) {
+	raw, ok := setting[key]
+	if !ok || raw == nil {
+		return 0, false, nil
+	}
+	d, err := parseMongoDuration(raw)
+	if err != nil {
+		return 0, false, mongoSettingError(key, err)
+	}
+	return d, true, nil
+}
+
+func parseMongoDuration(raw Any) (time.Duration, error) {
+	switch vv := raw.(type) {
+	case time.Duration:
+		if vv < 0 {
+			return 0, fmt.Errorf("negative duration %s", vv)
+		}
+		return vv, nil
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(vv))
+		if err != nil {
+			return 0, err
+		}
+		if d < 0 {
+			return 0, fmt.Errorf("negative duration %s", d)
+		}
+		return d, nil
+	default:
+		n, ok := parseInt64(raw)
+		if !ok {
+			return 0, fmt.Errorf("expected duration string or seconds, got %T", raw)
+		}
+		if n < 0 {
+			return 0, fmt.Errorf("negative duration %d", n)
+		}
+		return time.Duration(n) * time.Second, nil
+	}
+}
+
+func parseMongoTLS(raw Any) (*tls.Config, error) {
+	switch vv := raw.(type) {
+	case nil:
+		return nil, nil
+	case bool, string:
+		on, ok := parseBool(vv)
+		if !ok {
+			return nil, fmt.Errorf("expected bool or table, got %v", vv)
+		}
+		if !on {
+			return nil, nil
+		}
+		return &tls.Config{}, nil
+	case Map:
+		if e, ok := vv["enable"]; ok {
+			on, yes := parseBool(e)
+			if !yes {
+				return nil, fmt.Errorf("enable expects bool, got %v", e)
+			}
+			if !on {
+				return nil, nil
+			}
+		}
+		files := map[string]string{}
+		for _, key := range []string{"caFile", "certFile", "keyFile"} {
+			if raw, ok := vv[key]; ok && raw != nil {
+				s, ok := raw.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s expects string, got %T", key, raw)
+				}
+				files[key] = strings.TrimSpace(s)
+			}
+		}
+		cfg := &tls.Config{}
+		if caFile := files["caFile"]; caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("read caFile: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("caFile %s contains no PEM certificates", caFile)
+			}
+			cfg.RootCAs = pool
+		}
+		certFile, keyFile := files["certFile"], files["keyFile"]
+		if certFile != "" || keyFile != "" {
+			if keyFile == "" {
+				keyFile = certFile
+			}
+			if certFile == "" {
+				return nil, fmt.Errorf("keyFile requires certFile")
+			}
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("load certFile/keyFile: %w", err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		if raw, ok := vv["insecure"]; ok {
+			on, yes := parseBool(raw)
+			if !yes {
+				return nil, fmt.Errorf("insecure expects bool, got %v", raw)
+			}
+			cfg.InsecureSkipVerify = on
+		}
+		return cfg, nil
+	default:
+		return nil, fmt.Errorf("expected bool or table, got %T", raw)
+	}
+}
+
+func parseMongoReadPref(raw Any) (*readpref.ReadPref, error) {
+	mode := ""
+	var opts []readpref.Option
+	switch vv := raw.(type) {
+	case *readpref.ReadPref:
+		if vv == nil {
+			return nil, fmt.Errorf("nil read preference")
+		}
+		return vv, nil
+	case string:
+		mode = vv
+	case Map:
+		mode, _ = vv["mode"].(string)
+		if rawStale, ok := vv["maxStaleness"]; ok {
+			d, err := parseMongoDuration(rawStale)
+			if err != nil {
+				return nil, fmt.Errorf("maxStaleness: %w", err)
+			}
+			if d > 0 {
+				opts = append(opts, readpref.WithMaxStaleness(d))
+			}
+		}
+		if rawTags, ok := vv["tags"]; ok {
+			sets, err := parseMongoTagSets(rawTags)
+			if err != nil {
+				return nil, err
+			}
+			if len(sets) > 0 {
+				opts = append(opts, readpref.WithTagSets(sets...))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected mode string or table, got %T", raw)
+	}
+	m, err := readpref.ModeFromString(strings.TrimSpace(mode))
+	if err != nil {
+		return nil, err
+	}
+	return readpref.New(m, opts...)
+}
+
+func parseMongoTagSets(raw Any) ([]tag.Set, error) {
+	toSet := func(v Any) (tag.Set, error) {
+		m, ok := v.(Map)
+		if !ok {
+			return nil, fmt.Errorf("tags expects tables of string values, got %T", v)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		set := tag.Set{}
+		for _, k := range keys {
+			set = append(set, tag.Tag{Name: k, Value: fmt.Sprintf("%v", m[k])})
+		}
+		return set, nil
+	}
+	switch vv := raw.(type) {
+	case Map:
+		set, err := toSet(vv)
+		if err != nil {
+			return nil, err
+		}
+		return []tag.Set{set}, nil
+	case []Map:
+		out := make([]tag.Set, 0, len(vv))
+		for _, one := range vv {
+			set, err := toSet(one)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, set)
+		}
+		return out, nil
+	case []Any:
+		out := make([]tag.Set, 0, len(vv))
+		for _, one := range vv {
+			set, err := toSet(one)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, set)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("tags expects a table or list of tables, got %T", raw)
+	}
+}
+
+func parseMongoReadConcern(raw Any) (*readconcern.ReadConcern, error) {
+	level := ""
+	switch vv := raw.(type) {
+	case *readconcern.ReadConcern:
+		if vv == nil {
+			return nil, fmt.Errorf("nil read concern")
+		}
+		return vv, nil
+	case string:
+		level = vv
+	case Map:
+		level, _ = vv["level"].(string)
+	default:
+		return nil, fmt.Errorf("expected level string, got %T", raw)
+	}
+	level = strings.ToLower(strings.TrimSpace(level))
+	switch level {
+	case "local", "majority", "available", "linearizable", "snapshot":
+		return &readconcern.ReadConcern{Level: level}, nil
+	default:
+		return nil, fmt.Errorf("unknown read concern level %q", level)
+	}
+}
+
+func parseMongoWriteConcern(raw Any) (*writeconcern.WriteConcern, error) {
+	wc := &writeconcern.WriteConcern{}
+	setW := func(v Any) error {
+		switch vv := v.(type) {
+		case string:
+			vv = strings.TrimSpace(vv)
+			if vv == "" {
+				return fmt.Errorf("empty w")
+			}
+			if n, err := strconv.Atoi(vv); err == nil {
+				if n < 0 {
+					return fmt.Errorf("negative w %d", n)
+				}
+				wc.W = n
+				return nil
+			}
+			wc.W = vv
+			return nil
+		default:
+			n, ok := parseIntAny(v)
+			if !ok {
+				return fmt.Errorf("w expects number or string, got %T", v)
+			}
+			if n < 0 {
+				return fmt.Errorf("negative w %d", n)
+			}
+			wc.W = n
+			return nil
+		}
+	}
+	switch vv := raw.(type) {
+	case *writeconcern.WriteConcern:
+		if vv == nil {
+			return nil, fmt.Errorf("nil write concern")
+		}
+		return vv, nil
+	case Map:
+		if w, ok := vv["w"]; ok {
+			if err := setW(w); err != nil {
+				return nil, err
+			}
+		}
+		if j, ok := vv["j"]; ok {
+			on, yes := parseBool(j)
+			if !yes {
+				return nil, fmt.Errorf("j expects bool, got %v", j)
+			}
+			wc.Journal = &on
+		}
+		if t, ok := vv["wtimeout"]; ok {
+			d, err := parseMongoDuration(t)
+			if err != nil {
+				return nil, fmt.Errorf("wtimeout: %w", err)
+			}
+			wc.WTimeout = d
+		}
+	default:
+		if err := setW(raw); err != nil {
+			return nil, err
+		}
+	}
+	if !wc.IsValid() {
+		return nil, fmt.Errorf("w=0 cannot be combined with j=true")
+	}
+	return wc, nil
+}
@@ -0,0 +1,92 @@
+package data_mongodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestBuildMongoClientOptions(t *testing.T) {
+	opt, err := buildMongoClientOptions("mongodb://127.0.0.1:27017", data.Config{}, Map{
+		"replicaSet":             "rs0",
+		"appName":                "orders",
+		"compressors":            "zstd,snappy",
+		"readPreference":         Map{"mode": "secondaryPreferred", "maxStaleness": "120s", "tags": Map{"dc": "east"}},
+		"readConcern":            "majority",
+		"writeConcern":           Map{"w": "majority", "j": true, "wtimeout": "2s"},
+		"authSource":             "admin",
+		"serverSelectionTimeout": 3,
+		"retryWrites":            false,
+	})
+	if err != nil {
+		t.Fatalf("build client options failed: %v", err)
+	}
+	if opt.ReplicaSet == nil || *opt.ReplicaSet != "rs0" {
+		t.Fatalf("expected replica set rs0, got %v", opt.ReplicaSet)
+	}
+	if opt.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+		t.Fatalf("unexpected read preference %v", opt.ReadPreference)
+	}
+	if stale, ok := opt.ReadPreference.MaxStaleness(); !ok || stale != 120*time.Second {
+		t.Fatalf("unexpected max staleness %v", stale)
+	}
+	if opt.ReadConcern.Level != "majority" {
+		t.Fatalf("unexpected read concern %v", opt.ReadConcern)
+	}
+	if opt.WriteConcern.W != "majority" || !opt.WriteConcern.GetJ() || opt.WriteConcern.WTimeout != 2*time.Second {
+		t.Fatalf("unexpected write concern %#v", opt.WriteConcern)
+	}
+	if opt.Auth == nil || opt.Auth.AuthSource != "admin" {
+		t.Fatalf("unexpected auth %#v", opt.Auth)
+	}
+	if opt.ServerSelectionTimeout == nil || *opt.ServerSelectionTimeout != 3*time.Second {
+		t.Fatalf("unexpected server selection timeout %v", opt.ServerSelectionTimeout)
+	}
+	if opt.RetryWrites == nil || *opt.RetryWrites {
+		t.Fatalf("expected retryWrites=false")
+	}
+}
+
+func TestBuildMongoClientOptionsRejectsInvalid(t *testing.T) {
+	cases := []Map{
+		{"readPreference": "sometimes"},
+		{"readConcern": "eventual"},
+		{"writeConcern": Map{"w": 0, "j": true}},
+		{"compressors": "gzip"},
+		{"socketTimeout": "soon"},
+		{"retryReads": "maybe"},
+		{"authMechanism": "NTLM"},
+		{"tls": Map{"caFile": 42}},
+		{"tls": Map{"certFile": true}},
+		{"tls": Map{"certFile": "client.pem", "keyFile": []string{"client.key"}}},
+	}
+	for _, setting := range cases {
+		if _, err := buildMongoClientOptions("mongodb://127.0.0.1:27017", data.Config{}, setting); !errors.Is(err, data.ErrValidation) {
+			t.Fatalf("expected validation error for %v, got %v", setting, err)
+		}
+	}
+}
+
+func TestWithReadPreferenceDerivesHandle(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "main"}, mode: "auto-clear"}
+	db := WithReadPreference(base, Map{"mode": "secondary", "tags": []Map{{"dc": "east"}, {}}})
+	derived, ok := db.(*mongoBase)
+	if !ok || derived == base {
+		t.Fatalf("expected a derived handle, got %T", db)
+	}
+	if derived.rp == nil || derived.rp.Mode() != readpref.SecondaryMode || len(derived.rp.TagSets()) != 2 {
+		t.Fatalf("unexpected derived read preference %v", derived.rp)
+	}
+	if base.rp != nil {
+		t.Fatalf("base handle must keep the client default read preference")
+	}
+
+	bad := WithReadPreference(base, "sometimes")
+	if err := bad.Error(); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
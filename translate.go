@@ -0,0 +1,245 @@
+package data_mongodb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TranslatedQuery is the native form a view sends for a set of query args:
+// a find filter with options or an aggregation pipeline (count included).
+type TranslatedQuery struct {
+	Op         string
+	Collection string
+	Filter     bson.M
+	Find       *options.FindOptions
+	Pipeline   mongo.Pipeline
+	Command    bson.D
+}
+
+func (q TranslatedQuery) Aggregate() bool {
+	return q.Pipeline != nil
+}
+
+// AsPipeline returns the aggregation pipeline, rewriting a find into
+// $match/$sort/$skip/$limit/$project stages.
+func (q TranslatedQuery) AsPipeline() mongo.Pipeline {
+	if q.Pipeline != nil {
+		return q.Pipeline
+	}
+	pipeline := mongo.Pipeline{}
+	if len(q.Filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: q.Filter}})
+	}
+	if q.Find == nil {
+		return pipeline
+	}
+	if q.Find.Sort != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: q.Find.Sort}})
+	}
+	if q.Find.Skip != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: *q.Find.Skip}})
+	}
+	if q.Find.Limit != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: *q.Find.Limit}})
+	}
+	if q.Find.Projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: q.Find.Projection}})
+	}
+	return pipeline
+}
+
+// ExtJSON renders the command document as relaxed Extended JSON.
+func (q TranslatedQuery) ExtJSON() (string, error) {
+	raw, err := bson.MarshalExtJSON(orderedBson(q.Command), false, false)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// PipelineExtJSON renders AsPipeline as a JSON array accepted by AggregateRaw.
+func (q TranslatedQuery) PipelineExtJSON() (string, error) {
+	stages := make([]string, 0, len(q.AsPipeline()))
+	for _, stage := range q.AsPipeline() {
+		raw, err := bson.MarshalExtJSON(orderedBson(stage), false, false)
+		if err != nil {
+			return "", err
+		}
+		stages = append(stages, string(raw))
+	}
+	return "[" + strings.Join(stages, ",") + "]", nil
+}
+
+func (t *mongoTable) ToPipeline(args ...Any) TranslatedQuery {
+	return (*mongoView)(t).ToPipeline(args...)
+}
+func (m *mongoModel) ToPipeline(args ...Any) TranslatedQuery { return m.mongoView.ToPipeline(args...) }
+
+func (v *mongoView) ToPipeline(args ...Any) TranslatedQuery {
+	opts, args := splitExplainOptions(args)
+	tq, err := v.translate(opts.Op, opts.Field, args...)
+	v.base.setError(err)
+	return tq
+}
+
+func (v *mongoView) translate(op, field string, args ...Any) (TranslatedQuery, error) {
+	raw := op
+	op = strings.ToLower(strings.TrimSpace(op))
+	if op == "" {
+		op = "query"
+	}
+	q, err := data.Parse(args...)
+	if err != nil {
+		return TranslatedQuery{}, err
+	}
+	switch op {
+	case "query", "count", "slice":
+	case "first":
+		q.Limit = 1
+	case "aggregate":
+		if len(q.Aggs) == 0 {
+			q.Aggs = []data.Agg{{Alias: "$count", Op: "count", Field: "*"}}
+		}
+	case "group":
+		if len(q.Group) == 0 && strings.TrimSpace(field) != "" {
+			q.Group = []string{strings.TrimSpace(field)}
+		}
+		if len(q.Group) == 0 {
+			return TranslatedQuery{}, data.Error("translate", data.ErrValidation, fmt.Errorf("group requires a field"))
+		}
+		if len(q.Aggs) == 0 {
+			q.Aggs = []data.Agg{{Alias: "$count", Op: "count", Field: "*"}}
+		}
+	default:
+		return TranslatedQuery{}, data.Error("translate", data.ErrValidation, fmt.Errorf("unsupported op %q", raw))
+	}
+	q = v.mapQuery(q)
+	v.applyTrashScope(&q)
+	if op == "slice" && len(q.Sort) == 0 {
+		if key := strings.TrimSpace(v.storageField(v.key)); key != "" {
+			q.Sort = []data.Sort{{Field: key}}
+		}
+	}
+
+	out := TranslatedQuery{Op: op, Collection: v.source}
+	switch {
+	case op == "count":
+		filter, err := exprToFilter(q.Filter)
+		if err != nil {
+			return out, err
+		}
+		// the same pipeline CountDocuments sends, so Explain matches what Count runs
+		out.Filter = filter
+		out.Pipeline = mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$group", Value: bson.D{{Key: "_id", Value: 1}, {Key: "n", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		}
+		out.Command = bson.D{{Key: "aggregate", Value: v.source}, {Key: "pipeline", Value: out.Pipeline}, {Key: "cursor", Value: bson.M{}}}
+	case len(q.Aggs) > 0 || len(q.Group) > 0:
+		pipeline, _, _, err := v.pipelineSpec(applyAfter(q))
+		if err != nil {
+			return out, err
+		}
+		out.Pipeline = pipeline
+		out.Command = bson.D{{Key: "aggregate", Value: v.source}, {Key: "pipeline", Value: pipeline}, {Key: "cursor", Value: bson.M{}}}
+	default:
+		filter, findOpts, err := v.findSpec(applyAfter(q))
+		if err != nil {
+			return out, err
+		}
+		out.Filter, out.Find = filter, findOpts
+		out.Command = findCommandDoc(v.source, filter, findOpts)
+	}
+	return out, nil
+}
+
+func findCommandDoc(collection string, filter bson.M, opts *options.FindOptions) bson.D {
+	cmd := bson.D{{Key: "find", Value: collection}, {Key: "filter", Value: filter}}
+	if opts == nil {
+		return cmd
+	}
+	if opts.Projection != nil {
+		cmd = append(cmd, bson.E{Key: "projection", Value: opts.Projection})
+	}
+	if opts.Sort != nil {
+		cmd = append(cmd, bson.E{Key: "sort", Value: opts.Sort})
+	}
+	if opts.Skip != nil {
+		cmd = append(cmd, bson.E{Key: "skip", Value: *opts.Skip})
+	}
+	if opts.Limit != nil {
+		cmd = append(cmd, bson.E{Key: "limit", Value: *opts.Limit})
+	}
+	if opts.BatchSize != nil {
+		cmd = append(cmd, bson.E{Key: "batchSize", Value: *opts.BatchSize})
+	}
+	return cmd
+}
+
+// orderedBson rewrites unordered maps into key-sorted documents so the
+// rendered JSON is stable; bson.D keeps its own order.
+func orderedBson(v Any) Any {
+	switch vv := v.(type) {
+	case bson.D:
+		out := make(bson.D, 0, len(vv))
+		for _, elem := range vv {
+			out = append(out, bson.E{Key: elem.Key, Value: orderedBson(elem.Value)})
+		}
+		return out
+	case bson.M:
+		return orderedBsonMap(vv)
+	case Map:
+		return orderedBsonMap(vv)
+	case mongo.Pipeline:
+		out := bson.A{}
+		for _, stage := range vv {
+			out = append(out, orderedBson(stage))
+		}
+		return out
+	case []bson.M:
+		out := bson.A{}
+		for _, one := range vv {
+			out = append(out, orderedBson(one))
+		}
+		return out
+	case []Map:
+		out := bson.A{}
+		for _, one := range vv {
+			out = append(out, orderedBson(one))
+		}
+		return out
+	case bson.A:
+		out := bson.A{}
+		for _, one := range vv {
+			out = append(out, orderedBson(one))
+		}
+		return out
+	case []Any:
+		out := bson.A{}
+		for _, one := range vv {
+			out = append(out, orderedBson(one))
+		}
+		return out
+	}
+	return v
+}
+
+func orderedBsonMap(m map[string]any) bson.D {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(bson.D, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, bson.E{Key: k, Value: orderedBson(m[k])})
+	}
+	return out
+}
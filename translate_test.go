@@ -0,0 +1,74 @@
+package data_mongodb
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTranslatedQueryExtJSON(t *testing.T) {
+	findOpts := options.Find().SetSort(bson.D{{Key: "z", Value: -1}, {Key: "a", Value: 1}}).SetSkip(20).SetLimit(10)
+	filter := bson.M{"status": "paid", "amount": bson.M{"$lt": 100, "$gt": 5}}
+	tq := TranslatedQuery{Op: "query", Collection: "orders", Filter: filter, Find: findOpts, Command: findCommandDoc("orders", filter, findOpts)}
+
+	cmd, err := tq.ExtJSON()
+	want := `{"find":"orders","filter":{"amount":{"$gt":5,"$lt":100},"status":"paid"},"sort":{"z":-1,"a":1},"skip":20,"limit":10}`
+	if err != nil || cmd != want {
+		t.Fatalf("unexpected command json\n got %s\nwant %s (%v)", cmd, want, err)
+	}
+	if tq.Aggregate() {
+		t.Fatalf("find translation reported as aggregate")
+	}
+
+	pipe, err := tq.PipelineExtJSON()
+	want = `[{"$match":{"amount":{"$gt":5,"$lt":100},"status":"paid"}},{"$sort":{"z":-1,"a":1}},{"$skip":20},{"$limit":10}]`
+	if err != nil || pipe != want {
+		t.Fatalf("unexpected pipeline json\n got %s\nwant %s (%v)", pipe, want, err)
+	}
+	parsed, err := parsePipelineArg(pipe)
+	if err != nil || len(parsed) != 4 {
+		t.Fatalf("pipeline json must round-trip into AggregateRaw, got %v / %v", parsed, err)
+	}
+}
+
+func TestViewToPipeline(t *testing.T) {
+	view := &mongoView{base: &mongoBase{inst: &data.Instance{Name: "ledger"}, mode: "auto-clear"}, name: "orders", source: "orders", key: "id"}
+
+	tq := view.ToPipeline(ExplainOptions{Op: "slice"})
+	if err := view.base.Error(); err != nil || tq.Aggregate() {
+		t.Fatalf("expected find translation, got %+v / %v", tq, err)
+	}
+	if sort, ok := tq.Find.Sort.(bson.D); !ok || len(sort) != 1 || sort[0].Key != "id" {
+		t.Fatalf("expected default key sort for slice, got %#v", tq.Find.Sort)
+	}
+
+	tq = view.ToPipeline(ExplainOptions{Op: "group", Field: "status"})
+	if err := view.base.Error(); err != nil || !tq.Aggregate() {
+		t.Fatalf("expected pipeline translation, got %+v / %v", tq, err)
+	}
+	if tq.Command[0].Key != "aggregate" || tq.Pipeline[len(tq.Pipeline)-1][0].Key != "$group" {
+		t.Fatalf("unexpected group translation %v", tq.Command)
+	}
+
+	tq = view.ToPipeline(ExplainOptions{Op: "count"})
+	if tq.Command[0].Key != "aggregate" {
+		t.Fatalf("count should translate to the CountDocuments aggregate, got %v", tq.Command)
+	}
+	if stages := tq.AsPipeline(); len(stages) != 2 || stages[0][0].Key != "$match" || stages[1][0].Key != "$group" {
+		t.Fatalf("unexpected count pipeline %v", stages)
+	}
+
+	tq = view.ToPipeline(ExplainOptions{Op: "first"})
+	if tq.Find == nil || tq.Find.Limit == nil || *tq.Find.Limit != 1 {
+		t.Fatalf("expected limit 1 for first, got %+v", tq.Find)
+	}
+
+	view.ToPipeline(Map{}, ExplainOptions{Op: "upsert"})
+	if !errors.Is(view.base.Error(), data.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", view.base.Error())
+	}
+}
@@ -0,0 +1,205 @@
+package data_mongodb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const mongoDefaultTxTimeout = 10 * time.Second
+
+const (
+	mongoTxAuto    = "auto"
+	mongoTxRequire = "require"
+	mongoTxOff     = "off"
+)
+
+type mongoTx struct {
+	mutex sync.Mutex
+	ctx   mongo.SessionContext
+	close func()
+	pend  []func()
+}
+
+type TxOptions struct {
+	ReadConcern    Any
+	WriteConcern   Any
+	ReadPreference Any
+	MaxCommitTime  time.Duration
+	Timeout        time.Duration
+}
+
+func (b *mongoBase) WithTxOptions(opts TxOptions) data.DataBase {
+	clone := b.derive()
+	clone.txOpts = &opts
+	if _, _, err := clone.transactionOptions(); err != nil {
+		clone.setError(err)
+	}
+	return clone
+}
+
+func (b *mongoBase) transactionOptions() (*options.TransactionOptions, time.Duration, error) {
+	merged := TxOptions{}
+	if b.inst != nil && b.inst.Config.Setting != nil {
+		setting := b.inst.Config.Setting
+		merged.ReadConcern = setting["txReadConcern"]
+		merged.WriteConcern = setting["txWriteConcern"]
+		merged.ReadPreference = setting["txReadPreference"]
+		for _, key := range []string{"txMaxCommitTime", "txTimeout"} {
+			d, _, err := mongoSettingDuration(setting, key)
+			if err != nil {
+				return nil, 0, err
+			}
+			if key == "txTimeout" {
+				merged.Timeout = d
+			} else {
+				merged.MaxCommitTime = d
+			}
+		}
+	}
+	b.mutex.RLock()
+	override := b.txOpts
+	b.mutex.RUnlock()
+	if override != nil {
+		if override.ReadConcern != nil {
+			merged.ReadConcern = override.ReadConcern
+		}
+		if override.WriteConcern != nil {
+			merged.WriteConcern = override.WriteConcern
+		}
+		if override.ReadPreference != nil {
+			merged.ReadPreference = override.ReadPreference
+		}
+		if override.MaxCommitTime > 0 {
+			merged.MaxCommitTime = override.MaxCommitTime
+		}
+		if override.Timeout > 0 {
+			merged.Timeout = override.Timeout
+		}
+	}
+
+	out := options.Transaction()
+	if merged.ReadConcern != nil {
+		rc, err := parseMongoReadConcern(merged.ReadConcern)
+		if err != nil {
+			return nil, 0, txOptionError("readConcern", err)
+		}
+		out.SetReadConcern(rc)
+	}
+	if merged.WriteConcern != nil {
+		wc, err := parseMongoWriteConcern(merged.WriteConcern)
+		if err != nil {
+			return nil, 0, txOptionError("writeConcern", err)
+		}
+		out.SetWriteConcern(wc)
+	}
+	if merged.ReadPreference != nil {
+		rp, err := parseMongoReadPref(merged.ReadPreference)
+		if err != nil {
+			return nil, 0, txOptionError("readPreference", err)
+		}
+		out.SetReadPreference(rp)
+	}
+	if merged.MaxCommitTime > 0 {
+		mct := merged.MaxCommitTime
+		out.SetMaxCommitTime(&mct)
+	}
+	// 0 leaves the choice to txRootContext: handle timeout, then the default
+	timeout := merged.Timeout
+	if merged.MaxCommitTime > 0 && timeout < merged.MaxCommitTime {
+		timeout = merged.MaxCommitTime
+	}
+	return out, timeout, nil
+}
+
+func txOptionError(key string, err error) error {
+	return data.Error("tx.options", data.ErrValidation, fmt.Errorf("invalid transaction %s: %w", key, err))
+}
+
+func parseMongoTxMode(setting Map) (string, error) {
+	raw, ok := setting["tx"]
+	if !ok || raw == nil {
+		return mongoTxAuto, nil
+	}
+	mode, ok := raw.(string)
+	if !ok {
+		return "", mongoSettingError("tx", fmt.Errorf("expected string, got %v", raw))
+	}
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "":
+		return mongoTxAuto, nil
+	case mongoTxAuto, mongoTxRequire, mongoTxOff:
+		return mode, nil
+	}
+	return "", mongoSettingError("tx", fmt.Errorf("unknown mode %q", mode))
+}
+
+func (c *mongodbConnection) transactions() bool {
+	if c == nil || c.txMode == mongoTxOff {
+		return false
+	}
+	if c.txMode == mongoTxRequire {
+		return true
+	}
+	// auto only opts in once the monitor has classified a non-standalone server
+	switch c.monitor.status().Topology {
+	case "", "unknown", "standalone":
+		return false
+	}
+	return true
+}
+
+func (c *mongodbConnection) warnNoTx() {
+	c.txWarn.Do(func() {
+		name := ""
+		if c.instance != nil {
+			name = c.instance.Name
+		}
+		mongoLogf("mongodb %s: transactions unavailable (tx=%s), running callbacks without a session", name, c.txMode)
+	})
+}
+
+func (tx *mongoTx) sessionContext() mongo.SessionContext {
+	if tx == nil {
+		return nil
+	}
+	tx.mutex.Lock()
+	defer tx.mutex.Unlock()
+	return tx.ctx
+}
+
+func (tx *mongoTx) enqueue(fn func()) bool {
+	if tx == nil {
+		return false
+	}
+	tx.mutex.Lock()
+	defer tx.mutex.Unlock()
+	if tx.ctx == nil {
+		return false
+	}
+	tx.pend = append(tx.pend, fn)
+	return true
+}
+
+func (tx *mongoTx) finish() []func() {
+	if tx == nil {
+		return nil
+	}
+	tx.mutex.Lock()
+	pending := tx.pend
+	closeFn := tx.close
+	tx.ctx = nil
+	tx.pend = nil
+	tx.close = nil
+	tx.mutex.Unlock()
+	if closeFn != nil {
+		closeFn()
+	}
+	return pending
+}
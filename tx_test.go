@@ -0,0 +1,339 @@
+package data_mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/data"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/description"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestMongoTransactionOptions(t *testing.T) {
+	base := &mongoBase{
+		inst: &data.Instance{Name: "ledger", Config: data.Config{Setting: Map{
+			"txReadConcern":   "majority",
+			"txWriteConcern":  "majority",
+			"txMaxCommitTime": "20s",
+		}}},
+		mode: "auto-clear",
+	}
+	opts, timeout, err := base.transactionOptions()
+	if err != nil {
+		t.Fatalf("transaction options failed: %v", err)
+	}
+	if opts.ReadConcern.Level != "majority" || opts.WriteConcern.W != "majority" {
+		t.Fatalf("unexpected concerns %#v %#v", opts.ReadConcern, opts.WriteConcern)
+	}
+	if opts.MaxCommitTime == nil || *opts.MaxCommitTime != 20*time.Second || timeout != 20*time.Second {
+		t.Fatalf("unexpected commit window %v / %s", opts.MaxCommitTime, timeout)
+	}
+
+	derived := base.WithTxOptions(TxOptions{ReadConcern: "snapshot", ReadPreference: "primary", Timeout: time.Minute}).(*mongoBase)
+	opts, timeout, err = derived.transactionOptions()
+	if err != nil {
+		t.Fatalf("derived transaction options failed: %v", err)
+	}
+	if opts.ReadConcern.Level != "snapshot" || opts.ReadPreference.Mode() != readpref.PrimaryMode || timeout != time.Minute {
+		t.Fatalf("unexpected derived options %#v / %s", opts, timeout)
+	}
+	if base.txOpts != nil {
+		t.Fatalf("base handle must not inherit derived transaction options")
+	}
+
+	bad := base.WithTxOptions(TxOptions{ReadConcern: "eventual"})
+	if err := bad.Error(); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestMongoMutationEventsDeferredUntilCommit(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "ledger"}, mode: "auto-clear"}
+	ran := 0
+	base.afterCommit(func() { ran++ })
+	if ran != 1 {
+		t.Fatalf("expected immediate flush outside transactions, got %d", ran)
+	}
+
+	tx := &mongoTx{ctx: mongo.NewSessionContext(context.Background(), nil)}
+	base.tx = tx
+	base.afterCommit(func() { ran++ })
+	base.afterCommit(func() { ran++ })
+	if ran != 1 {
+		t.Fatalf("expected events buffered inside transaction, got %d", ran)
+	}
+	runTxPending(tx.finish())
+	if ran != 3 {
+		t.Fatalf("expected buffered events flushed after commit, got %d", ran)
+	}
+	if base.inTx() {
+		t.Fatalf("expected finished transaction to be inactive")
+	}
+	if len(tx.finish()) != 0 {
+		t.Fatalf("expected pending events cleared after flush")
+	}
+}
+
+func TestMongoDerivedHandlesAreIsolated(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "ledger"}, mode: "auto-clear", ctx: context.Background()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	withCtx := base.WithContext(ctx).(*mongoBase)
+	withTmo := base.WithTimeout(time.Second).(*mongoBase)
+	if withCtx == base || withTmo == base {
+		t.Fatalf("expected derived handles")
+	}
+	if base.ctx != context.Background() || base.tmo != 0 {
+		t.Fatalf("base handle mutated by derivation")
+	}
+	if withCtx.ctx != ctx || withTmo.tmo != time.Second {
+		t.Fatalf("derived handle lost its settings")
+	}
+
+	withCtx.setError(errors.New("boom"))
+	if base.err != nil || withTmo.err != nil {
+		t.Fatalf("error state leaked across handles")
+	}
+
+	tx := &mongoTx{ctx: mongo.NewSessionContext(context.Background(), nil)}
+	withCtx.tx = tx
+	if base.inTx() || withTmo.inTx() {
+		t.Fatalf("transaction leaked across handles")
+	}
+	if !withCtx.derive().inTx() {
+		t.Fatalf("handles derived inside a transaction must share it")
+	}
+	tx.finish()
+}
+
+func TestMongoTxModeSetting(t *testing.T) {
+	for raw, want := range map[string]string{"": mongoTxAuto, "auto": mongoTxAuto, "Require": mongoTxRequire, " off ": mongoTxOff} {
+		mode, err := parseMongoTxMode(Map{"tx": raw})
+		if err != nil || mode != want {
+			t.Fatalf("tx=%q: got %q, %v", raw, mode, err)
+		}
+	}
+	if mode, err := parseMongoTxMode(Map{}); err != nil || mode != mongoTxAuto {
+		t.Fatalf("expected auto by default, got %q, %v", mode, err)
+	}
+	if _, err := parseMongoTxMode(Map{"tx": "sometimes"}); !errors.Is(err, data.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	standalone := &description.Topology{Kind: description.Single, Servers: []description.Server{{Kind: description.Standalone}}}
+	cases := []struct {
+		mode string
+		desc *description.Topology
+		want bool
+	}{
+		{mongoTxAuto, nil, false},
+		{mongoTxAuto, &description.Topology{Kind: description.Single}, false},
+		{mongoTxAuto, standalone, false},
+		{mongoTxAuto, &description.Topology{Kind: description.ReplicaSetWithPrimary}, true},
+		{mongoTxOff, &description.Topology{Kind: description.ReplicaSetWithPrimary}, false},
+		{mongoTxRequire, nil, true},
+		{mongoTxRequire, standalone, true},
+	}
+	for i, c := range cases {
+		conn := &mongodbConnection{txMode: c.mode, monitor: newMongoMonitorWithTopology(c.desc)}
+		if got := conn.transactions(); got != c.want {
+			t.Fatalf("case %d tx=%s topology=%s: got %v", i, c.mode, conn.monitor.status().Topology, got)
+		}
+	}
+}
+
+// newMongoMonitorWithTopology records desc through the monitor's topology
+// event, leaving it "unknown" when desc is nil.
+func newMongoMonitorWithTopology(desc *description.Topology) *mongoMonitor {
+	monitor := newMongoMonitor("local", 0)
+	if desc != nil {
+		monitor.topologyChanged(&event.TopologyDescriptionChangedEvent{NewDescription: *desc})
+	}
+	return monitor
+}
+
+func TestMongoTxFallbackWithoutSession(t *testing.T) {
+	cli := newLazyMongoClient(t)
+	standalone := description.Topology{Kind: description.Single, Servers: []description.Server{{Kind: description.Standalone}}}
+	conn := &mongodbConnection{instance: &data.Instance{Name: "local"}, client: cli, txMode: mongoTxAuto, monitor: newMongoMonitorWithTopology(&standalone)}
+	base := &mongoBase{inst: conn.instance, conn: conn, mode: "auto-clear"}
+	ran := 0
+	res := base.Tx(func(tx data.DataBase) Res {
+		if tx.(*mongoBase).inTx() {
+			t.Fatalf("expected callback without a session")
+		}
+		tx.(*mongoBase).afterCommit(func() { ran++ })
+		return nil
+	})
+	if res.Fail() || ran != 1 {
+		t.Fatalf("expected fallback to run callback, got %v / %d", res, ran)
+	}
+	if err := base.Begin(); err != nil || base.inTx() {
+		t.Fatalf("expected Begin to be a no-op without transactions, got %v", err)
+	}
+	if base.Capabilities().Transactions {
+		t.Fatalf("expected transactions unavailable on standalone")
+	}
+}
+
+func TestMongoSessionHandle(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "ledger"}, mode: "auto-clear"}
+	res := base.Session(func(db data.DataBase) Res { return nil })
+	if !res.Fail() || !strings.Contains(res.Error(), "invalid mongodb connection") {
+		t.Fatalf("expected driver error without connection, got %v", res)
+	}
+	if err := base.Error(); err != nil {
+		t.Fatalf("Session must not leave its error on the receiver, got %v", err)
+	}
+
+	tx := &mongoTx{ctx: mongo.NewSessionContext(context.Background(), nil)}
+	base.tx = tx
+	defer tx.finish()
+	var got data.DataBase
+	res = base.Session(func(db data.DataBase) Res {
+		got = db
+		return nil
+	})
+	if res.Fail() || got != data.DataBase(base) {
+		t.Fatalf("expected nested session to reuse the transaction handle, got %v", res)
+	}
+}
+
+type captureLogger struct{ lines []string }
+
+func (c *captureLogger) Printf(format string, args ...any) {
+	c.lines = append(c.lines, fmt.Sprintf(format, args...))
+}
+
+func TestMongoNoTxWarningUsesLogger(t *testing.T) {
+	logger := &captureLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+	conn := &mongodbConnection{instance: &data.Instance{Name: "local"}, txMode: mongoTxOff}
+	conn.warnNoTx()
+	conn.warnNoTx()
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "transactions unavailable") {
+		t.Fatalf("expected a single warning through the package logger, got %q", logger.lines)
+	}
+}
+
+func TestMongoBeginOnBaseHandle(t *testing.T) {
+	cli := newLazyMongoClient(t)
+	conn := &mongodbConnection{instance: &data.Instance{Name: "local"}, client: cli, txMode: mongoTxOff}
+	db := conn.Base(conn.instance)
+	if err := db.Begin(); err != nil {
+		t.Fatalf("Begin on a base handle must keep working, got %v", err)
+	}
+	if err := db.Commit(); err != nil {
+		t.Fatalf("Commit after Begin must keep working, got %v", err)
+	}
+}
+
+func TestMongoTxKeepsErrorsOffTheReceiver(t *testing.T) {
+	cli := newLazyMongoClient(t)
+	conn := &mongodbConnection{instance: &data.Instance{Name: "local"}, client: cli, txMode: mongoTxOff}
+	base := &mongoBase{inst: conn.instance, conn: conn, mode: "sticky"}
+	boom := errors.New("boom")
+
+	failed := base.Tx(func(tx data.DataBase) Res {
+		tx.(*mongoBase).setError(boom)
+		return nil
+	})
+	ok := base.Tx(func(tx data.DataBase) Res { return nil })
+	if !failed.Fail() || ok.Fail() {
+		t.Fatalf("expected each Tx to report its own outcome, got %v / %v", failed, ok)
+	}
+	if err := base.Error(); err != nil {
+		t.Fatalf("Tx must not leave its error on the shared receiver, got %v", err)
+	}
+}
+
+func newLazyMongoClient(t *testing.T) *mongo.Client {
+	t.Helper()
+	// Connect does not dial; an unroutable port keeps any stray operation short
+	opts := options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(50 * time.Millisecond)
+	cli, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = cli.Disconnect(context.Background()) })
+	return cli
+}
+
+func TestMongoWithContextAndTimeoutReturnNewHandles(t *testing.T) {
+	base := &mongoBase{inst: &data.Instance{Name: "ledger"}, mode: "auto-clear"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the receiver is left untouched when the returned handle is ignored
+	base.WithContext(ctx)
+	base.WithTimeout(time.Millisecond)
+	opCtx, opCancel := base.opContext(0)
+	if opCtx.Err() != nil {
+		t.Fatalf("receiver picked up the derived context")
+	}
+	if _, ok := opCtx.Deadline(); ok {
+		t.Fatalf("receiver picked up the derived timeout")
+	}
+	opCancel()
+
+	derived := base.WithContext(ctx).(*mongoBase)
+	opCtx, opCancel = derived.opContext(0)
+	if !errors.Is(opCtx.Err(), context.Canceled) {
+		t.Fatalf("derived handle must use its own context, got %v", opCtx.Err())
+	}
+	opCancel()
+
+	timed := base.WithTimeout(time.Minute).(*mongoBase)
+	opCtx, opCancel = timed.opContext(0)
+	defer opCancel()
+	if deadline, ok := opCtx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("derived handle must apply its own timeout, got %v / %v", deadline, ok)
+	}
+}
+
+func TestMongoTxTimeoutPrecedence(t *testing.T) {
+	deadlineIn := func(b *mongoBase, timeout time.Duration) time.Duration {
+		ctx, cancel := b.txRootContext(timeout, mongoDefaultTxTimeout)
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatalf("expected a deadline")
+		}
+		return time.Until(deadline).Round(time.Second)
+	}
+
+	base := &mongoBase{inst: &data.Instance{Name: "ledger", Config: data.Config{Setting: Map{"txTimeout": "30s"}}}, mode: "auto-clear"}
+	timed := base.WithTimeout(time.Second).(*mongoBase)
+	_, timeout, err := timed.transactionOptions()
+	if err != nil {
+		t.Fatalf("transaction options failed: %v", err)
+	}
+	if got := deadlineIn(timed, timeout); got != 30*time.Second {
+		t.Fatalf("txTimeout must win over the handle timeout, got %s", got)
+	}
+
+	override := timed.WithTxOptions(TxOptions{Timeout: time.Minute}).(*mongoBase)
+	_, timeout, _ = override.transactionOptions()
+	if got := deadlineIn(override, timeout); got != time.Minute {
+		t.Fatalf("TxOptions.Timeout must win over settings, got %s", got)
+	}
+
+	plain := &mongoBase{inst: &data.Instance{Name: "ledger"}, mode: "auto-clear"}
+	_, timeout, _ = plain.WithTimeout(3 * time.Second).(*mongoBase).transactionOptions()
+	if got := deadlineIn(plain.WithTimeout(3*time.Second).(*mongoBase), timeout); got != 3*time.Second {
+		t.Fatalf("handle timeout applies when no tx timeout is set, got %s", got)
+	}
+	if got := deadlineIn(plain, timeout); got != mongoDefaultTxTimeout {
+		t.Fatalf("expected default tx timeout, got %s", got)
+	}
+}